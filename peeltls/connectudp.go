@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	fhttp2 "github.com/Danny-Dasilva/fhttp/http2"
+	"github.com/Danny-Dasilva/fhttp/http2/hpack"
+	tls "github.com/refraction-networking/utls"
+)
+
+// settingEnableConnectProtocol is RFC 8441's SETTINGS_ENABLE_CONNECT_PROTOCOL
+// (id 0x8), which a server advertises to say it accepts Extended CONNECT
+// (the ":protocol" pseudo-header) — the mechanism RFC 9298 layers HTTP
+// CONNECT-UDP on top of. fhttp2 predates RFC 8441 and has no constant for it.
+const settingEnableConnectProtocol fhttp2.SettingID = 0x8
+
+// capsuleTypeDatagram is RFC 9297's DATAGRAM Capsule Type, used to carry an
+// HTTP Datagram (here, one UDP proxying payload) inside the bytestream of an
+// Extended CONNECT stream when native QUIC/H3 datagrams aren't in play.
+const capsuleTypeDatagram = 0x00
+
+// udpProxyingContextID is RFC 9298's Context ID for UDP payload capsules.
+// UDP proxying defines no other context ID.
+const udpProxyingContextID = 0
+
+// appendVarint appends v to b using the QUIC variable-length integer
+// encoding (RFC 9000 §16): the top two bits of the first byte select a
+// 1/2/4/8-byte encoding, and the remaining bits hold the value.
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 63:
+		return append(b, byte(v))
+	case v <= 16383:
+		return append(b, byte(v>>8)|0x40, byte(v))
+	case v <= 1073741823:
+		return append(b, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	case v <= 4611686018427387903:
+		return append(b, byte(v>>56)|0xc0, byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		panic("appendVarint: value exceeds 62 bits")
+	}
+}
+
+// readVarint decodes one QUIC variable-length integer from the start of b,
+// returning the value and the number of bytes it occupied.
+func readVarint(b []byte) (v uint64, n int, err error) {
+	if len(b) == 0 {
+		return 0, 0, fmt.Errorf("varint: empty input")
+	}
+	n = 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0, fmt.Errorf("varint: need %d bytes, have %d", n, len(b))
+	}
+	v = uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n, nil
+}
+
+// encodeDatagramCapsule wraps payload as an RFC 9297 Capsule carrying an
+// RFC 9298 UDP proxying payload: Capsule Type (DATAGRAM) + Capsule Length +
+// Context ID (always 0 for UDP payload) + payload.
+func encodeDatagramCapsule(payload []byte) []byte {
+	value := appendVarint(nil, udpProxyingContextID)
+	value = append(value, payload...)
+
+	capsule := appendVarint(nil, capsuleTypeDatagram)
+	capsule = appendVarint(capsule, uint64(len(value)))
+	return append(capsule, value...)
+}
+
+// capsuleParser extracts complete capsules from a byte stream that may
+// deliver them split across multiple DATA frames, the way HTTP/2 frames a
+// bytestream without preserving capsule boundaries.
+type capsuleParser struct {
+	buf []byte
+}
+
+func (p *capsuleParser) feed(b []byte) {
+	p.buf = append(p.buf, b...)
+}
+
+// next returns the next complete capsule's type and value, consuming it
+// from the buffer. ok is false if the buffer doesn't yet hold a full capsule.
+func (p *capsuleParser) next() (typ uint64, value []byte, ok bool) {
+	typ, n1, err := readVarint(p.buf)
+	if err != nil {
+		return 0, nil, false
+	}
+	length, n2, err := readVarint(p.buf[n1:])
+	if err != nil {
+		return 0, nil, false
+	}
+	total := n1 + n2 + int(length)
+	if len(p.buf) < total {
+		return 0, nil, false
+	}
+	value = append([]byte(nil), p.buf[n1+n2:total]...)
+	p.buf = p.buf[total:]
+	return typ, value, true
+}
+
+// dialHTTPConnectUDP negotiates an RFC 9298 HTTP CONNECT-UDP tunnel to
+// targetAddr through a single HTTP/2 proxy and returns a net.PacketConn that
+// relays datagrams to it — the HTTP-proxy counterpart to
+// dialSOCKS5UDPAssociate, used when the proxy is an https:// CONNECT proxy
+// rather than a socks5:// one. Proxy chaining isn't supported here for the
+// same reason it isn't for SOCKS5 UDP ASSOCIATE: each hop would need its own
+// relay.
+func dialHTTPConnectUDP(chain ProxyChain, targetAddr string, timeout, keepalive time.Duration) (net.PacketConn, error) {
+	if len(chain) != 1 {
+		return nil, fmt.Errorf("http CONNECT-UDP requires exactly one proxy hop, got %d", len(chain))
+	}
+	proxyURL, err := url.Parse(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %s", chain[0], err)
+	}
+	if !strings.EqualFold(proxyURL.Scheme, "https") {
+		return nil, fmt.Errorf("http CONNECT-UDP requires an https:// proxy negotiating h2, got %q", proxyURL.Scheme)
+	}
+
+	targetHost, targetPort, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target address %q: %s", targetAddr, err)
+	}
+
+	conn, err := dialProxyTransport(nil, proxyURL, timeout, keepalive)
+	if err != nil {
+		return nil, fmt.Errorf("proxy connect failed: %s", err)
+	}
+	tlsConn, ok := conn.(*tls.UConn)
+	if !ok || tlsConn.ConnectionState().NegotiatedProtocol != "h2" {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %q did not negotiate h2, required for http CONNECT-UDP", proxyURL.Host)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c := &connectUDPConn{conn: conn, fr: fhttp2.NewFramer(conn, conn)}
+	c.fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := c.handshake(proxyURL, targetHost, targetPort); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.recvCh = make(chan []byte, 16)
+	c.closeCh = make(chan struct{})
+	go c.readLoop()
+
+	return c, nil
+}
+
+// connectUDPConn is a net.PacketConn relaying UDP datagrams, each wrapped in
+// an RFC 9297 capsule, over stream 1 of an HTTP/2 connection to a proxy that
+// accepted our RFC 9298 Extended CONNECT request.
+type connectUDPConn struct {
+	conn     net.Conn
+	fr       *fhttp2.Framer
+	writeMu  sync.Mutex
+	recvCh   chan []byte
+	closeCh  chan struct{}
+	closeErr error
+	once     sync.Once
+}
+
+// handshake sends the Extended CONNECT request (RFC 8441 + RFC 9298) on
+// stream 1 and waits for the proxy's 200 response, confirming along the way
+// that it advertised SETTINGS_ENABLE_CONNECT_PROTOCOL.
+func (c *connectUDPConn) handshake(proxyURL *url.URL, targetHost, targetPort string) error {
+	if _, err := c.conn.Write([]byte(fhttp2.ClientPreface)); err != nil {
+		return fmt.Errorf("connect-udp: writing client preface: %s", err)
+	}
+	if err := c.fr.WriteSettings(); err != nil {
+		return fmt.Errorf("connect-udp: writing initial SETTINGS: %s", err)
+	}
+
+	var buf bytes.Buffer
+	henc := hpack.NewEncoder(&buf)
+	henc.WriteField(hpack.HeaderField{Name: ":method", Value: "CONNECT"})
+	henc.WriteField(hpack.HeaderField{Name: ":protocol", Value: "connect-udp"})
+	henc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "https"})
+	henc.WriteField(hpack.HeaderField{Name: ":path", Value: fmt.Sprintf("/.well-known/masque/udp/%s/%s/", targetHost, targetPort)})
+	henc.WriteField(hpack.HeaderField{Name: ":authority", Value: proxyHostPort(proxyURL)})
+	if err := c.fr.WriteHeaders(fhttp2.HeadersFrameParam{StreamID: 1, BlockFragment: buf.Bytes(), EndHeaders: true}); err != nil {
+		return fmt.Errorf("connect-udp: writing request HEADERS: %s", err)
+	}
+
+	sawServerSettings := false
+	for {
+		f, err := c.fr.ReadFrame()
+		if err != nil {
+			return fmt.Errorf("connect-udp: reading handshake frame: %s", err)
+		}
+		switch f := f.(type) {
+		case *fhttp2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			if v, ok := f.Value(settingEnableConnectProtocol); !ok || v != 1 {
+				return fmt.Errorf("connect-udp: proxy %q did not advertise SETTINGS_ENABLE_CONNECT_PROTOCOL", proxyURL.Host)
+			}
+			sawServerSettings = true
+			c.fr.WriteSettingsAck()
+		case *fhttp2.MetaHeadersFrame:
+			if !sawServerSettings {
+				return fmt.Errorf("connect-udp: proxy %q sent HEADERS before SETTINGS", proxyURL.Host)
+			}
+			if status := f.PseudoValue("status"); status != "200" {
+				return fmt.Errorf("connect-udp: proxy rejected CONNECT-UDP: status %s", status)
+			}
+			return nil
+		case *fhttp2.GoAwayFrame:
+			return fmt.Errorf("connect-udp: proxy sent GOAWAY during handshake: %s", f.ErrCode)
+		case *fhttp2.PingFrame:
+			if !f.IsAck() {
+				c.fr.WritePing(true, f.Data)
+			}
+		}
+	}
+}
+
+// readLoop drains frames for the life of the connection, reassembling
+// capsules from stream-1 DATA frames into recvCh and answering protocol
+// housekeeping (SETTINGS acks, PING acks) the way handshake does.
+func (c *connectUDPConn) readLoop() {
+	var parser capsuleParser
+	for {
+		f, err := c.fr.ReadFrame()
+		if err != nil {
+			c.fail(fmt.Errorf("connect-udp: connection closed: %s", err))
+			return
+		}
+		switch f := f.(type) {
+		case *fhttp2.DataFrame:
+			parser.feed(f.Data())
+			for {
+				typ, value, ok := parser.next()
+				if !ok {
+					break
+				}
+				if typ != capsuleTypeDatagram {
+					continue
+				}
+				ctxID, n, err := readVarint(value)
+				if err != nil || ctxID != udpProxyingContextID {
+					continue
+				}
+				payload := append([]byte(nil), value[n:]...)
+				select {
+				case c.recvCh <- payload:
+				case <-c.closeCh:
+					return
+				}
+			}
+		case *fhttp2.SettingsFrame:
+			if !f.IsAck() {
+				c.writeMu.Lock()
+				c.fr.WriteSettingsAck()
+				c.writeMu.Unlock()
+			}
+		case *fhttp2.PingFrame:
+			if !f.IsAck() {
+				c.writeMu.Lock()
+				c.fr.WritePing(true, f.Data)
+				c.writeMu.Unlock()
+			}
+		case *fhttp2.RSTStreamFrame:
+			c.fail(fmt.Errorf("connect-udp: proxy reset the tunnel stream: %s", f.ErrCode))
+			return
+		case *fhttp2.GoAwayFrame:
+			c.fail(fmt.Errorf("connect-udp: proxy sent GOAWAY: %s", f.ErrCode))
+			return
+		}
+	}
+}
+
+func (c *connectUDPConn) fail(err error) {
+	c.once.Do(func() {
+		c.closeErr = err
+		close(c.closeCh)
+	})
+}
+
+func (c *connectUDPConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.fr.WriteData(1, false, encodeDatagramCapsule(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *connectUDPConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case payload := <-c.recvCh:
+		return copy(p, payload), c.conn.RemoteAddr(), nil
+	case <-c.closeCh:
+		return 0, nil, c.closeErr
+	}
+}
+
+func (c *connectUDPConn) Close() error {
+	c.fail(fmt.Errorf("connect-udp: closed"))
+	return c.conn.Close()
+}
+
+func (c *connectUDPConn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+func (c *connectUDPConn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *connectUDPConn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *connectUDPConn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVarintRoundTrip(t *testing.T) {
+	cases := []uint64{0, 1, 63, 64, 16383, 16384, 1073741823, 1073741824, 4611686018427387903}
+	for _, v := range cases {
+		b := appendVarint(nil, v)
+		got, n, err := readVarint(b)
+		if err != nil {
+			t.Fatalf("readVarint(%d) returned error: %s", v, err)
+		}
+		if n != len(b) {
+			t.Errorf("readVarint(%d) consumed %d bytes, want %d", v, n, len(b))
+		}
+		if got != v {
+			t.Errorf("readVarint(appendVarint(%d)) = %d", v, got)
+		}
+	}
+}
+
+func TestReadVarintShortInput(t *testing.T) {
+	// First byte says "4-byte encoding" but only one byte is present.
+	if _, _, err := readVarint([]byte{0x80}); err == nil {
+		t.Error("readVarint with a truncated varint should have errored")
+	}
+	if _, _, err := readVarint(nil); err == nil {
+		t.Error("readVarint(nil) should have errored")
+	}
+}
+
+func TestEncodeDecodeDatagramCapsule(t *testing.T) {
+	payload := []byte("hello udp proxying")
+	capsule := encodeDatagramCapsule(payload)
+
+	var p capsuleParser
+	p.feed(capsule)
+	typ, value, ok := p.next()
+	if !ok {
+		t.Fatal("capsuleParser.next() = false, want a complete capsule")
+	}
+	if typ != capsuleTypeDatagram {
+		t.Errorf("capsule type = %d, want %d", typ, capsuleTypeDatagram)
+	}
+
+	ctxID, n, err := readVarint(value)
+	if err != nil {
+		t.Fatalf("readVarint(context id) returned error: %s", err)
+	}
+	if ctxID != udpProxyingContextID {
+		t.Errorf("context id = %d, want %d", ctxID, udpProxyingContextID)
+	}
+	if !bytes.Equal(value[n:], payload) {
+		t.Errorf("capsule payload = %q, want %q", value[n:], payload)
+	}
+}
+
+// TestCapsuleParserAcrossFeeds checks a capsule split across two feed()
+// calls — modeling a datagram capsule arriving across separate DATA frames
+// — isn't returned until the full capsule has been fed.
+func TestCapsuleParserAcrossFeeds(t *testing.T) {
+	capsule := encodeDatagramCapsule([]byte("split payload"))
+	mid := len(capsule) / 2
+
+	var p capsuleParser
+	p.feed(capsule[:mid])
+	if _, _, ok := p.next(); ok {
+		t.Fatal("capsuleParser.next() returned a capsule before it was fully fed")
+	}
+
+	p.feed(capsule[mid:])
+	typ, value, ok := p.next()
+	if !ok {
+		t.Fatal("capsuleParser.next() = false after the full capsule was fed")
+	}
+	if typ != capsuleTypeDatagram {
+		t.Errorf("capsule type = %d, want %d", typ, capsuleTypeDatagram)
+	}
+	_, n, _ := readVarint(value)
+	if string(value[n:]) != "split payload" {
+		t.Errorf("capsule payload = %q, want %q", value[n:], "split payload")
+	}
+}
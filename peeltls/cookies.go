@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CookieInfo is the JSON-safe view of a session's cookie returned by
+// GET /session/{id}/cookies.
+type CookieInfo struct {
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"httpOnly,omitempty"`
+}
+
+// importCookies seeds the session's jar (and cookie listing) from cookies
+// parsed off a Netscape cookie file, or any other *http.Cookie slice.
+// Cookies are grouped by domain so CookieJar.SetCookies sees one RFC
+// 6265-valid target URL per domain instead of one per cookie.
+func (s *Session) importCookies(cookies []*http.Cookie) {
+	byDomain := make(map[string][]*http.Cookie)
+	for _, c := range cookies {
+		domain := strings.TrimPrefix(c.Domain, ".")
+		byDomain[domain] = append(byDomain[domain], c)
+	}
+	for domain, group := range byDomain {
+		u := &url.URL{Scheme: "https", Host: domain}
+		s.CookieJar.SetCookies(u, group)
+		s.recordCookies(domain, group)
+	}
+}
+
+// parseNetscapeCookies parses the classic Netscape/cURL cookie-file format
+// (one tab-separated record per line: domain, includeSubdomains, path,
+// secure, expires, name, value), as exported by browser extensions. Blank
+// lines and comment lines (including the "# Netscape HTTP Cookie File"
+// header) are skipped, except for curl's "#HttpOnly_" domain prefix, which
+// marks the cookie on that line as HttpOnly.
+func parseNetscapeCookies(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			httpOnly = true
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		} else if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("malformed cookie line %q: want 7 tab-separated fields, got %d", line, len(fields))
+		}
+		domain, includeSubdomains, path, secure, expiresField, name, value := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+		expiresUnix, err := strconv.ParseInt(expiresField, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed cookie line %q: invalid expires %q: %s", line, expiresField, err)
+		}
+		var expires time.Time
+		if expiresUnix > 0 {
+			expires = time.Unix(expiresUnix, 0)
+		}
+
+		if includeSubdomains == "TRUE" && !strings.HasPrefix(domain, ".") {
+			domain = "." + domain
+		}
+
+		cookies = append(cookies, &http.Cookie{
+			Domain:   domain,
+			Path:     path,
+			Secure:   secure == "TRUE",
+			HttpOnly: httpOnly,
+			Expires:  expires,
+			Name:     name,
+			Value:    value,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cookie file: %s", err)
+	}
+	return cookies, nil
+}
+
+// formatNetscapeCookies renders cookies in the Netscape/cURL cookie-file
+// format, the inverse of parseNetscapeCookies.
+func formatNetscapeCookies(cookies []storedCookie) []byte {
+	var b strings.Builder
+	b.WriteString("# Netscape HTTP Cookie File\n")
+	for _, c := range cookies {
+		includeSubdomains := "FALSE"
+		domain := c.Domain
+		if strings.HasPrefix(domain, ".") {
+			includeSubdomains = "TRUE"
+		}
+		secure := "FALSE"
+		if c.Secure {
+			secure = "TRUE"
+		}
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+		prefix := ""
+		if c.HTTPOnly {
+			prefix = "#HttpOnly_"
+		}
+		fmt.Fprintf(&b, "%s%s\t%s\t%s\t%s\t%d\t%s\t%s\n", prefix, domain, includeSubdomains, c.Path, secure, expires, c.Name, c.Value)
+	}
+	return []byte(b.String())
+}
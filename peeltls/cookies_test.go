@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNetscapeCookies(t *testing.T) {
+	const file = `# Netscape HTTP Cookie File
+# This is a comment and should be skipped
+
+.example.com	TRUE	/	TRUE	1893456000	session	abc123
+#HttpOnly_example.org	FALSE	/login	FALSE	0	flag	yes
+`
+	cookies, err := parseNetscapeCookies(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("parseNetscapeCookies returned error: %s", err)
+	}
+	if len(cookies) != 2 {
+		t.Fatalf("got %d cookies, want 2", len(cookies))
+	}
+
+	c0 := cookies[0]
+	if c0.Domain != ".example.com" || c0.Path != "/" || c0.Name != "session" || c0.Value != "abc123" {
+		t.Errorf("cookie[0] = %+v, unexpected fields", c0)
+	}
+	if !c0.Secure || c0.HttpOnly {
+		t.Errorf("cookie[0] Secure/HttpOnly = %v/%v, want true/false", c0.Secure, c0.HttpOnly)
+	}
+	if c0.Expires.IsZero() || c0.Expires.Unix() != 1893456000 {
+		t.Errorf("cookie[0].Expires = %v, want unix 1893456000", c0.Expires)
+	}
+
+	c1 := cookies[1]
+	if c1.Domain != "example.org" || c1.Name != "flag" || c1.Value != "yes" {
+		t.Errorf("cookie[1] = %+v, unexpected fields", c1)
+	}
+	if !c1.HttpOnly {
+		t.Error("cookie[1].HttpOnly = false, want true (from #HttpOnly_ prefix)")
+	}
+	if !c1.Expires.IsZero() {
+		t.Errorf("cookie[1].Expires = %v, want zero (session cookie, expires=0)", c1.Expires)
+	}
+}
+
+func TestParseNetscapeCookiesIncludeSubdomains(t *testing.T) {
+	cookies, err := parseNetscapeCookies(strings.NewReader("example.com\tTRUE\t/\tFALSE\t0\tname\tval\n"))
+	if err != nil {
+		t.Fatalf("parseNetscapeCookies returned error: %s", err)
+	}
+	if len(cookies) != 1 || cookies[0].Domain != ".example.com" {
+		t.Errorf("domain = %q, want includeSubdomains=TRUE to add the leading dot", cookies[0].Domain)
+	}
+}
+
+func TestParseNetscapeCookiesMalformed(t *testing.T) {
+	if _, err := parseNetscapeCookies(strings.NewReader("too\tfew\tfields\n")); err == nil {
+		t.Error("expected an error for a line with the wrong number of fields")
+	}
+	if _, err := parseNetscapeCookies(strings.NewReader("example.com\tTRUE\t/\tFALSE\tnotanumber\tname\tval\n")); err == nil {
+		t.Error("expected an error for a malformed expires field")
+	}
+}
+
+func TestFormatNetscapeCookiesRoundTrip(t *testing.T) {
+	in := []storedCookie{
+		{Domain: ".example.com", Path: "/", Name: "a", Value: "1", Secure: true, Expires: time.Unix(1893456000, 0)},
+		{Domain: "example.org", Path: "/x", Name: "b", Value: "2", HTTPOnly: true},
+	}
+	out := formatNetscapeCookies(in)
+
+	parsed, err := parseNetscapeCookies(strings.NewReader(string(out)))
+	if err != nil {
+		t.Fatalf("parseNetscapeCookies(formatNetscapeCookies(in)) returned error: %s", err)
+	}
+	if len(parsed) != len(in) {
+		t.Fatalf("round-tripped %d cookies, want %d", len(parsed), len(in))
+	}
+	if parsed[0].Domain != in[0].Domain || parsed[0].Name != in[0].Name || parsed[0].Value != in[0].Value || !parsed[0].Secure {
+		t.Errorf("round-tripped cookie[0] = %+v, want to match %+v", parsed[0], in[0])
+	}
+	if parsed[1].Domain != in[1].Domain || !parsed[1].HttpOnly {
+		t.Errorf("round-tripped cookie[1] = %+v, want HttpOnly from #HttpOnly_ prefix", parsed[1])
+	}
+}
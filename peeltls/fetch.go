@@ -19,14 +19,31 @@ import (
 
 // FetchRequest is the JSON body for POST /fetch
 type FetchRequest struct {
-	URL             string            `json:"url"`
-	Method          string            `json:"method"`
-	Headers         map[string]string `json:"headers"`
-	Fingerprint     string            `json:"fingerprint"`
-	Proxy           string            `json:"proxy"`
-	Timeout         int               `json:"timeout"`
-	FollowRedirects bool              `json:"followRedirects"`
-	MaxRedirects    int               `json:"maxRedirects"`
+	URL                string            `json:"url"`
+	Method             string            `json:"method"`
+	Headers            map[string]string `json:"headers"`
+	Fingerprint        string            `json:"fingerprint"`
+	HTTP2Fingerprint   string            `json:"http2Fingerprint"`
+	QUICFingerprint    string            `json:"quicFingerprint"`
+	Protocol           string            `json:"protocol"`
+	Proxy              ProxyChain        `json:"proxy"`
+	Timeout            int               `json:"timeout"`          // seconds; fallback budget for any phase below left unset
+	DialTimeout        int               `json:"dialTimeout"`      // milliseconds
+	TLSTimeout         int               `json:"tlsTimeout"`       // milliseconds
+	ReadTimeout        int               `json:"readTimeout"`      // milliseconds
+	KeepaliveTimeout   int               `json:"keepaliveTimeout"` // milliseconds
+	FollowRedirects    bool              `json:"followRedirects"`
+	MaxRedirects       int               `json:"maxRedirects"`
+	SessionID          string            `json:"sessionId"`
+	InsecureSkipVerify bool              `json:"insecureSkipVerify"` // requires the target host be on the server's skip-verify whitelist
+	CABundle           string            `json:"caBundle"`           // inline PEM string
+	ClientCert         string            `json:"clientCert"`         // PEM, for mTLS
+	ClientKey          string            `json:"clientKey"`          // PEM, for mTLS
+	Trace              bool              `json:"trace"`              // capture wire-level detail into FetchResponse.Trace
+	Stream             bool              `json:"stream"`             // pipe the decompressed body straight to the HTTP response instead of buffering it into Body
+	RangeStart         int64             `json:"rangeStart"`         // byte offset to resume a streamed fetch from, via an origin Range request
+	MaxBodyBytes       int64             `json:"maxBodyBytes"`       // streamed fetches only: abort once this many bytes have been forwarded (0 = unlimited)
+	MaxRetries         int               `json:"maxRetries"`         // streamed fetches only: re-issues on a dropped origin connection before giving up (0 = defaultStreamMaxRetries)
 }
 
 // FetchResponse is the JSON response for POST /fetch
@@ -36,16 +53,63 @@ type FetchResponse struct {
 	Body     string            `json:"body,omitempty"`
 	FinalURL string            `json:"finalUrl,omitempty"`
 	Timing   *FetchTiming      `json:"timing,omitempty"`
+	Trace    *TraceInfo        `json:"trace,omitempty"`
 	Error    string            `json:"error,omitempty"`
 }
 
 // FetchTiming holds timing info in milliseconds
 type FetchTiming struct {
 	DNSMS   int64 `json:"dnsMs"`
+	DialMS  int64 `json:"dialMs"`
 	TLSMS   int64 `json:"tlsMs"`
+	WriteMS int64 `json:"writeMs"`
+	ReadMS  int64 `json:"readMs"`
 	TotalMS int64 `json:"totalMs"`
 }
 
+// defaultPhaseTimeout is the fallback for any of Dial/TLS/Read left unset
+// on both FetchRequest.Timeout and its own field.
+const defaultPhaseTimeout = 30 * time.Second
+
+// defaultKeepaliveTimeout is the fallback TCP keepalive interval.
+const defaultKeepaliveTimeout = 30 * time.Second
+
+// Timeouts holds the independent phase budgets for a single fetch. Following
+// git-lfs's Client, dial/TLS/read are tracked separately instead of one
+// wall-clock budget applied via SetDeadline to the whole request, so a slow
+// handshake doesn't eat into the time available to read a large body.
+type Timeouts struct {
+	Dial      time.Duration
+	TLS       time.Duration
+	Read      time.Duration
+	Keepalive time.Duration
+}
+
+// resolveTimeouts fills in req's per-phase timeouts, falling back to
+// req.Timeout (seconds, the original single-budget field) for any phase
+// left unset, so existing callers that only set Timeout keep working
+// unchanged.
+func resolveTimeouts(req FetchRequest) Timeouts {
+	fallback := defaultPhaseTimeout
+	if req.Timeout > 0 {
+		fallback = time.Duration(req.Timeout) * time.Second
+	}
+	t := Timeouts{Dial: fallback, TLS: fallback, Read: fallback, Keepalive: defaultKeepaliveTimeout}
+	if req.DialTimeout > 0 {
+		t.Dial = time.Duration(req.DialTimeout) * time.Millisecond
+	}
+	if req.TLSTimeout > 0 {
+		t.TLS = time.Duration(req.TLSTimeout) * time.Millisecond
+	}
+	if req.ReadTimeout > 0 {
+		t.Read = time.Duration(req.ReadTimeout) * time.Millisecond
+	}
+	if req.KeepaliveTimeout > 0 {
+		t.Keepalive = time.Duration(req.KeepaliveTimeout) * time.Millisecond
+	}
+	return t
+}
+
 func doFetch(req FetchRequest) FetchResponse {
 	if req.Method == "" {
 		req.Method = "GET"
@@ -53,17 +117,23 @@ func doFetch(req FetchRequest) FetchResponse {
 	if req.Fingerprint == "" {
 		req.Fingerprint = "chrome-133"
 	}
-	if req.Timeout <= 0 {
-		req.Timeout = 30
-	}
 	if req.MaxRedirects <= 0 {
 		req.MaxRedirects = 10
 	}
 
-	timeout := time.Duration(req.Timeout) * time.Second
+	timeouts := resolveTimeouts(req)
+	trust, err := resolveTLSTrust(req)
+	if err != nil {
+		return FetchResponse{Error: err.Error()}
+	}
 	totalStart := time.Now()
 	timing := &FetchTiming{}
 
+	var trace *TraceInfo
+	if traceEnabled(req) {
+		trace = &TraceInfo{}
+	}
+
 	currentURL := req.URL
 	visited := make(map[string]bool)
 	redirectCount := 0
@@ -74,7 +144,7 @@ func doFetch(req FetchRequest) FetchResponse {
 		}
 		visited[currentURL] = true
 
-		resp, err := fetchOnce(currentURL, req.Method, req.Headers, req.Fingerprint, req.Proxy, timeout, timing)
+		resp, err := fetchOnce(currentURL, req.Method, req.Headers, req.Fingerprint, req.HTTP2Fingerprint, req.QUICFingerprint, req.Protocol, req.Proxy, req.SessionID, timeouts, trust, trace, timing)
 		if err != nil {
 			return FetchResponse{Error: err.Error(), Status: 0}
 		}
@@ -124,6 +194,7 @@ func doFetch(req FetchRequest) FetchResponse {
 			Body:     string(body),
 			FinalURL: currentURL,
 			Timing:   timing,
+			Trace:    trace,
 		}
 	}
 }
@@ -132,13 +203,64 @@ func isRedirect(status int) bool {
 	return status == 301 || status == 302 || status == 303 || status == 307 || status == 308
 }
 
+// rollingReadDeadlineConn wraps a net.Conn so every Read resets the read
+// deadline to now+timeout first, instead of one deadline covering the
+// whole response. A slow-but-still-trickling body then only needs each
+// individual read to land within timeout, not the transfer as a whole.
+type rollingReadDeadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *rollingReadDeadlineConn) Read(p []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+// withRollingReadDeadline wraps conn so reads are governed by a rolling
+// readTimeout deadline instead of whatever deadline a previous phase (dial
+// or TLS handshake) left in place. It also sets that deadline immediately,
+// covering the request write and the first read, so callers don't need a
+// separate write deadline of their own.
+func withRollingReadDeadline(conn net.Conn, readTimeout time.Duration) net.Conn {
+	conn.SetDeadline(time.Now().Add(readTimeout))
+	return &rollingReadDeadlineConn{Conn: conn, timeout: readTimeout}
+}
+
 // fetchOnce makes a single HTTP request (no redirects). Updates timing in-place.
-func fetchOnce(rawURL, method string, headers map[string]string, fingerprint, proxy string, timeout time.Duration, timing *FetchTiming) (*http.Response, error) {
+func fetchOnce(rawURL, method string, headers map[string]string, fingerprint, h2Fingerprint, quicFingerprint, protocol string, proxy ProxyChain, sessionID string, timeouts Timeouts, trust TLSTrust, trace *TraceInfo, timing *FetchTiming) (*http.Response, error) {
+	if protocol == "h3" {
+		return doHTTP3(rawURL, method, headers, fingerprint, quicFingerprint, proxy, timeouts, timing)
+	}
+
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid url: %s", err)
 	}
 
+	// A session locks in its own fingerprint/proxy at creation time, and
+	// pools H2 connections per host across calls. Fetches without a session
+	// ID keep today's one-shot behavior.
+	var sess *Session
+	if sessionID != "" {
+		s, ok := sessions.get(sessionID)
+		if !ok {
+			return nil, fmt.Errorf("unknown session %q", sessionID)
+		}
+		sess = s
+		if sess.Fingerprint != "" {
+			fingerprint = sess.Fingerprint
+		}
+		if sess.HTTP2Fingerprint != "" {
+			h2Fingerprint = sess.HTTP2Fingerprint
+		}
+		if len(sess.Proxy) > 0 {
+			proxy = sess.Proxy
+		}
+	}
+
+	headers = applySessionCookies(sess, parsedURL, headers)
+
 	hostname := parsedURL.Hostname()
 	port := parsedURL.Port()
 	if port == "" {
@@ -150,6 +272,59 @@ func fetchOnce(rawURL, method string, headers map[string]string, fingerprint, pr
 	}
 	addr := net.JoinHostPort(hostname, port)
 
+	// Reuse a pooled H2 connection for this host if the session has one,
+	// skipping DNS/dial/TLS entirely.
+	if sess != nil {
+		if h2cc := sess.getH2Conn(addr); h2cc != nil {
+			spec := resolveH2Fingerprint(h2Fingerprint)
+			traceH2Settings(trace, spec.Settings)
+			resp, err := doHTTP2OnConn(h2cc, spec.PseudoHeaderOrder, parsedURL, method, headers, timeouts.Read, trace)
+			if err != nil {
+				return nil, err
+			}
+			stdResp, err := readH2Response(resp, trace)
+			if err != nil {
+				return nil, err
+			}
+			saveSessionCookies(sess, parsedURL, stdResp)
+			return stdResp, nil
+		}
+	}
+
+	// Session-less fetches share the process-wide pool instead, keyed on
+	// everything that determines what's on the other end of the socket.
+	var key poolKey
+	if sess == nil {
+		key = newPoolKey(parsedURL.Scheme, addr, fingerprint, h2Fingerprint, proxy)
+
+		if h2cc := pool.getH2(key); h2cc != nil {
+			spec := resolveH2Fingerprint(h2Fingerprint)
+			traceH2Settings(trace, spec.Settings)
+			resp, err := doHTTP2OnConn(h2cc, spec.PseudoHeaderOrder, parsedURL, method, headers, timeouts.Read, trace)
+			if err == nil {
+				if stdResp, rerr := readH2Response(resp, trace); rerr == nil {
+					saveSessionCookies(sess, parsedURL, stdResp)
+					return stdResp, nil
+				}
+			}
+			pool.dropH2(key)
+			// Fall through to a fresh dial below.
+		}
+
+		if conn := pool.getH1(key); conn != nil {
+			resp, keepAlive, err := doHTTP1(withRollingReadDeadline(conn, timeouts.Read), parsedURL, method, headers, trace, timing)
+			if err == nil {
+				if keepAlive {
+					pool.putH1(key, conn)
+				}
+				saveSessionCookies(sess, parsedURL, resp)
+				return resp, nil
+			}
+			pool.dropH1(conn)
+			// Fall through to a fresh dial below.
+		}
+	}
+
 	// DNS resolution timing (best effort)
 	dnsStart := time.Now()
 	_, lookupErr := net.LookupHost(hostname)
@@ -157,28 +332,43 @@ func fetchOnce(rawURL, method string, headers map[string]string, fingerprint, pr
 		timing.DNSMS = time.Since(dnsStart).Milliseconds()
 	}
 
-	// Dial TCP (via proxy if specified)
-	var tcpConn net.Conn
-	if proxy != "" {
-		tcpConn, err = dialViaProxy(proxy, addr, timeout)
-	} else {
-		tcpConn, err = net.DialTimeout("tcp", addr, timeout)
-	}
+	// Dial TCP, through proxy if specified (dialViaProxy dials directly when empty).
+	dialStart := time.Now()
+	tcpConn, err := dialViaProxy(proxy, addr, timeouts.Dial, timeouts.Keepalive)
 	if err != nil {
 		return nil, fmt.Errorf("connection refused: %s", err)
 	}
-	tcpConn.SetDeadline(time.Now().Add(timeout))
+	timing.DialMS = time.Since(dialStart).Milliseconds()
 
 	// For HTTP (non-TLS) URLs, use plain connection
 	if parsedURL.Scheme == "http" {
-		return doHTTP1(tcpConn, parsedURL, method, headers)
+		resp, keepAlive, err := doHTTP1(withRollingReadDeadline(tcpConn, timeouts.Read), parsedURL, method, headers, trace, timing)
+		if err == nil {
+			saveSessionCookies(sess, parsedURL, resp)
+			if sess == nil && keepAlive {
+				pool.putH1(key, tcpConn)
+			}
+		}
+		return resp, err
 	}
 
 	// uTLS handshake
-	fpSpec := resolveFingerprint(fingerprint)
+	fpSpec, err := resolveFingerprint(fingerprint)
+	if err != nil {
+		tcpConn.Close()
+		return nil, fmt.Errorf("fingerprint resolution failed: %s", err)
+	}
+	if trust.InsecureSkipVerify && !skipVerifyAllowed(hostname) {
+		tcpConn.Close()
+		return nil, fmt.Errorf("insecureSkipVerify not permitted for host %q", hostname)
+	}
+	tcpConn.SetDeadline(time.Now().Add(timeouts.TLS))
 	tlsStart := time.Now()
 	tlsConn := tls.UClient(tcpConn, &tls.Config{
-		ServerName: hostname,
+		ServerName:         hostname,
+		InsecureSkipVerify: trust.InsecureSkipVerify,
+		RootCAs:            trust.RootCAs,
+		Certificates:       trust.Certificates,
 	}, fpSpec.ID)
 
 	// Apply custom spec (JA3) if provided
@@ -198,14 +388,152 @@ func fetchOnce(rawURL, method string, headers map[string]string, fingerprint, pr
 	// Check ALPN
 	alpn := tlsConn.ConnectionState().NegotiatedProtocol
 
+	if trace != nil {
+		helloSpec := fpSpec.CustomSpec
+		if helloSpec == nil {
+			if spec, err := tls.UTLSIdToSpec(fpSpec.ID); err == nil {
+				helloSpec = &spec
+			}
+		}
+		if helloSpec != nil {
+			ja3, ja3Hash := computeJA3(helloSpec)
+			traceClientHello(trace, ja3, ja3Hash, alpn)
+		}
+	}
+
+	var resp *http.Response
 	if alpn == "h2" {
 		// HTTP/2 path using fhttp — Chrome-like SETTINGS, header ordering, and window updates.
-		// fhttp is a BSD-3 fork of Go's net/http with HTTP/2 fingerprint support.
-		return doHTTP2fhttp(tlsConn, parsedURL, method, headers)
+		// fhttp is a BSD-3 fork of Go's net/http with HTTP/2 fingerprint support. The rolling
+		// read deadline applies for the life of the connection, not just this request.
+		h2Conn := withRollingReadDeadline(tlsConn, timeouts.Read)
+		traceH2Settings(trace, resolveH2Fingerprint(h2Fingerprint).Settings)
+		if sess != nil {
+			resp, err = doHTTP2OnSession(sess, addr, h2Conn, parsedURL, method, headers, h2Fingerprint, timeouts.Read, trace)
+		} else {
+			resp, err = doHTTP2OnPool(key, h2Conn, parsedURL, method, headers, h2Fingerprint, timeouts.Read, trace)
+		}
+	} else {
+		// HTTP/1.1 path over TLS
+		var keepAlive bool
+		resp, keepAlive, err = doHTTP1(withRollingReadDeadline(tlsConn, timeouts.Read), parsedURL, method, headers, trace, timing)
+		if err == nil && sess == nil && keepAlive {
+			pool.putH1(key, tlsConn)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	saveSessionCookies(sess, parsedURL, resp)
+
+	if protocol != "auto" {
+		return resp, nil
 	}
 
-	// HTTP/1.1 path over TLS
-	return doHTTP1(tlsConn, parsedURL, method, headers)
+	// protocol:"auto" — upgrade to H3 if the origin advertises it via Alt-Svc.
+	if !altSvcAdvertisesH3(resp.Header.Get("Alt-Svc")) {
+		return resp, nil
+	}
+	if h3resp, h3err := doHTTP3(rawURL, method, headers, fingerprint, quicFingerprint, proxy, timeouts, timing); h3err == nil {
+		resp.Body.Close()
+		return h3resp, nil
+	}
+	return resp, nil
+}
+
+// applySessionCookies returns headers with the session's jar cookies for url
+// merged into the Cookie header, leaving any cookie the caller already set
+// untouched. If sess is nil, headers is returned unchanged.
+func applySessionCookies(sess *Session, u *url.URL, headers map[string]string) map[string]string {
+	if sess == nil {
+		return headers
+	}
+	cookies := sess.CookieJar.Cookies(u)
+	if len(cookies) == 0 {
+		return headers
+	}
+
+	merged := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		merged[k] = v
+	}
+
+	parts := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		parts = append(parts, c.Name+"="+c.Value)
+	}
+	jarCookies := strings.Join(parts, "; ")
+
+	if existing, ok := merged["Cookie"]; ok && existing != "" {
+		merged["Cookie"] = existing + "; " + jarCookies
+	} else {
+		merged["Cookie"] = jarCookies
+	}
+	return merged
+}
+
+// saveSessionCookies stores any Set-Cookie headers on resp into the
+// session's jar. It's a no-op if sess is nil.
+func saveSessionCookies(sess *Session, u *url.URL, resp *http.Response) {
+	if sess == nil {
+		return
+	}
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		sess.CookieJar.SetCookies(u, cookies)
+		sess.recordCookies(u.Hostname(), cookies)
+	}
+}
+
+// doHTTP2OnPool performs the first HTTP/2 request on a freshly-handshaken
+// connection for a session-less fetch, then hands the resulting
+// *fhttp2.ClientConn to the process-wide pool instead of closing it, so
+// later fetches to the same (scheme, addr, fingerprint, proxy) reuse it.
+func doHTTP2OnPool(key poolKey, conn net.Conn, parsedURL *url.URL, method string, headers map[string]string, h2Fingerprint string, readTimeout time.Duration, trace *TraceInfo) (*http.Response, error) {
+	h2cc, spec, err := newH2ClientConn(conn, h2Fingerprint)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := doHTTP2OnConn(h2cc, spec.PseudoHeaderOrder, parsedURL, method, headers, readTimeout, trace)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	stdResp, err := readH2Response(resp, trace)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	pool.putH2(key, h2cc)
+	return stdResp, nil
+}
+
+// doHTTP2OnSession performs the first HTTP/2 request on a freshly-handshaken
+// connection for a session, then hands the resulting *fhttp2.ClientConn to
+// the session's pool instead of closing it, so later fetches on the same
+// session and host reuse it.
+func doHTTP2OnSession(sess *Session, addr string, conn net.Conn, parsedURL *url.URL, method string, headers map[string]string, h2Fingerprint string, readTimeout time.Duration, trace *TraceInfo) (*http.Response, error) {
+	h2cc, spec, err := newH2ClientConn(conn, h2Fingerprint)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := doHTTP2OnConn(h2cc, spec.PseudoHeaderOrder, parsedURL, method, headers, readTimeout, trace)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	stdResp, err := readH2Response(resp, trace)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sess.putH2Conn(addr, h2cc)
+	return stdResp, nil
 }
 
 // buildHTTPRequest creates an *http.Request with standard headers.
@@ -227,36 +555,57 @@ func buildHTTPRequest(method string, parsedURL *url.URL, headers map[string]stri
 	return req, nil
 }
 
-// doHTTP1 performs an HTTP/1.1 request over the given connection.
-func doHTTP1(conn net.Conn, parsedURL *url.URL, method string, headers map[string]string) (*http.Response, error) {
-	defer conn.Close()
-
+// doHTTP1 performs an HTTP/1.1 request over conn, recording write/read
+// phase timing into timing. It reports whether conn came back in a state
+// the caller can safely keep alive and reuse (the server didn't ask to
+// close, and nothing unread is left on the wire) — if not, doHTTP1 closes
+// conn itself before returning. A pooled caller reuses conn directly on a
+// keepAlive return; a one-shot caller just closes it. conn's per-read
+// deadline (readTimeout) is enforced by the caller wrapping conn with
+// withRollingReadDeadline before calling in, not here.
+func doHTTP1(conn net.Conn, parsedURL *url.URL, method string, headers map[string]string, trace *TraceInfo, timing *FetchTiming) (resp *http.Response, keepAlive bool, err error) {
 	req, err := buildHTTPRequest(method, parsedURL, headers)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build request: %s", err)
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to build request: %s", err)
 	}
+	traceHTTP1Request(trace, req)
 
 	// Write the request
+	writeStart := time.Now()
 	if err := req.Write(conn); err != nil {
-		return nil, fmt.Errorf("failed to write request: %s", err)
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to write request: %s", err)
 	}
+	timing.WriteMS = time.Since(writeStart).Milliseconds()
 
 	// Read the response
+	readStart := time.Now()
 	br := bufio.NewReader(conn)
-	resp, err := http.ReadResponse(br, req)
+	resp, err = http.ReadResponse(br, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %s", err)
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to read response: %s", err)
 	}
 
-	// Buffer the body before the connection closes
+	// Buffer the body before deciding the connection's fate
 	bodyBytes, err := io.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read body: %s", err)
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to read body: %s", err)
 	}
 	resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
-
-	return resp, nil
+	timing.ReadMS = time.Since(readStart).Milliseconds()
+	traceHTTP1Response(trace, resp)
+
+	// Anything still buffered means pipelined/unexpected data we don't know
+	// how to hand to the next user of this connection, so play it safe.
+	keepAlive = !resp.Close && br.Buffered() == 0
+	if !keepAlive {
+		conn.Close()
+	}
+	return resp, keepAlive, nil
 }
 
 // decompressBody decompresses the response body based on Content-Encoding.
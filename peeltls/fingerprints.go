@@ -1,7 +1,13 @@
 package main
 
 import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 
@@ -27,28 +33,39 @@ var presets = map[string]tls.ClientHelloID{
 }
 
 // resolveFingerprint returns the FingerprintSpec for the given fingerprint name.
-// If not found in presets, treats it as a JA3 string and parses it.
-// Falls back to Chrome 133 on error.
-func resolveFingerprint(fp string) FingerprintSpec {
+// If not found in presets, treats it as a JA4/JA4_R or JA3 string and parses it.
+// Falls back to Chrome 133 when fp is empty or doesn't match any known form.
+// A bare hashed JA4 string with no resolver configured is reported as an error
+// rather than silently falling back, since it can't be reconstructed.
+func resolveFingerprint(fp string) (FingerprintSpec, error) {
 	if fp == "" {
-		return FingerprintSpec{ID: tls.HelloChrome_133}
+		return FingerprintSpec{ID: tls.HelloChrome_133}, nil
 	}
 
 	// Check presets first
 	if id, ok := presets[strings.ToLower(fp)]; ok {
-		return FingerprintSpec{ID: id}
+		return FingerprintSpec{ID: id}, nil
+	}
+
+	// Try JA4 / JA4_R string parse
+	if isJA4String(fp) {
+		spec, err := resolveJA4(fp)
+		if err != nil {
+			return FingerprintSpec{}, err
+		}
+		return FingerprintSpec{ID: tls.HelloCustom, CustomSpec: spec}, nil
 	}
 
 	// Try JA3 string parse
 	if isJA3String(fp) {
 		spec, err := parseJA3(fp)
 		if err == nil {
-			return FingerprintSpec{ID: tls.HelloCustom, CustomSpec: spec}
+			return FingerprintSpec{ID: tls.HelloCustom, CustomSpec: spec}, nil
 		}
 	}
 
 	// Default
-	return FingerprintSpec{ID: tls.HelloChrome_133}
+	return FingerprintSpec{ID: tls.HelloChrome_133}, nil
 }
 
 // isJA3String checks if a string looks like a JA3 fingerprint.
@@ -126,13 +143,15 @@ func parseJA3(ja3 string) (*tls.ClientHelloSpec, error) {
 	}
 
 	// Build extensions list
-	spec.Extensions = buildExtensions(extIDs, groups, pointFormats)
+	spec.Extensions = buildExtensions(extIDs, groups, pointFormats, nil)
 
 	return spec, nil
 }
 
-// buildExtensions constructs a list of TLS extensions from JA3 extension IDs.
-func buildExtensions(extIDs []uint16, groups []tls.CurveID, pointFormats []uint8) []tls.TLSExtension {
+// buildExtensions constructs a list of TLS extensions from JA3/JA4 extension IDs.
+// sigAlgs overrides the Signature Algorithms extension's contents when the
+// caller knows the exact list (JA4_R); pass nil to use the JA3 default.
+func buildExtensions(extIDs []uint16, groups []tls.CurveID, pointFormats []uint8, sigAlgs []tls.SignatureScheme) []tls.TLSExtension {
 	var exts []tls.TLSExtension
 
 	for _, id := range extIDs {
@@ -156,8 +175,9 @@ func buildExtensions(extIDs []uint16, groups []tls.CurveID, pointFormats []uint8
 				exts = append(exts, &tls.SupportedPointsExtension{SupportedPoints: []uint8{0}})
 			}
 		case 13: // Signature Algorithms
-			exts = append(exts, &tls.SignatureAlgorithmsExtension{
-				SupportedSignatureAlgorithms: []tls.SignatureScheme{
+			algs := sigAlgs
+			if len(algs) == 0 {
+				algs = []tls.SignatureScheme{
 					tls.ECDSAWithP256AndSHA256,
 					tls.PSSWithSHA256,
 					tls.PKCS1WithSHA256,
@@ -166,7 +186,10 @@ func buildExtensions(extIDs []uint16, groups []tls.CurveID, pointFormats []uint8
 					tls.PKCS1WithSHA384,
 					tls.PSSWithSHA512,
 					tls.PKCS1WithSHA512,
-				},
+				}
+			}
+			exts = append(exts, &tls.SignatureAlgorithmsExtension{
+				SupportedSignatureAlgorithms: algs,
 			})
 		case 16: // ALPN
 			exts = append(exts, &tls.ALPNExtension{
@@ -210,6 +233,69 @@ func buildExtensions(extIDs []uint16, groups []tls.CurveID, pointFormats []uint8
 	return exts
 }
 
+// computeJA3 builds the JA3 string and its MD5 hash for the ClientHelloSpec
+// actually handshaken, for the trace feature (see FetchRequest.Trace). JA3
+// is "TLSVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats",
+// with GREASE values excluded, hashed with MD5 per the JA3 spec.
+func computeJA3(spec *tls.ClientHelloSpec) (ja3 string, hash string) {
+	// The ClientHello record's legacy_version is 0x0303 (771, TLS 1.2) even
+	// when TLS 1.3 is negotiated via the supported_versions extension, so
+	// real JA3 fingerprints almost always report 771 regardless of spec's
+	// actual TLSVersMax.
+	const legacyRecordVersion = 771
+
+	var ciphers, extensions, curves, pointFormats []string
+	for _, c := range spec.CipherSuites {
+		if !isGREASEUint16(uint16(c)) {
+			ciphers = append(ciphers, strconv.Itoa(int(c)))
+		}
+	}
+	for _, ext := range spec.Extensions {
+		if id, ok := extensionID(ext); ok && !isGREASEUint16(id) {
+			extensions = append(extensions, strconv.Itoa(int(id)))
+		}
+		switch e := ext.(type) {
+		case *tls.SupportedCurvesExtension:
+			for _, c := range e.Curves {
+				if !isGREASEUint16(uint16(c)) {
+					curves = append(curves, strconv.Itoa(int(c)))
+				}
+			}
+		case *tls.SupportedPointsExtension:
+			for _, p := range e.SupportedPoints {
+				pointFormats = append(pointFormats, strconv.Itoa(int(p)))
+			}
+		}
+	}
+
+	ja3 = fmt.Sprintf("%d,%s,%s,%s,%s", legacyRecordVersion,
+		strings.Join(ciphers, "-"), strings.Join(extensions, "-"),
+		strings.Join(curves, "-"), strings.Join(pointFormats, "-"))
+	sum := md5.Sum([]byte(ja3))
+	return ja3, hex.EncodeToString(sum[:])
+}
+
+// extensionID reads the 2-byte extension type out of ext's marshaled form,
+// since uTLS's TLSExtension interface doesn't expose it directly.
+func extensionID(ext tls.TLSExtension) (uint16, bool) {
+	buf := make([]byte, ext.Len())
+	n, err := ext.Read(buf)
+	if err != nil && err != io.EOF {
+		return 0, false
+	}
+	if n < 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(buf[:2]), true
+}
+
+// isGREASEUint16 reports whether v matches the GREASE pattern (high and low
+// bytes equal, low nibble 0xa) that browsers use to pad cipher/extension/
+// curve lists — excluded from JA3 since it varies per connection.
+func isGREASEUint16(v uint16) bool {
+	return v&0x0f0f == 0x0a0a
+}
+
 // parseUint16List parses a "-" separated list of uint16 values.
 func parseUint16List(s string) ([]uint16, error) {
 	if s == "" {
@@ -226,3 +312,185 @@ func parseUint16List(s string) ([]uint16, error) {
 	}
 	return result, nil
 }
+
+// ja4Resolver maps a hashed JA4 string to the raw JA4_R string it expands to.
+// JA3 is being phased out because it hashes with MD5 and hides TLS 1.3
+// signals; JA4/JA4_R is the replacement. A hash alone can't be turned back
+// into a ClientHello, so callers must seed this table (SetJA4Resolver or
+// LoadJA4ResolverFile) to use plain JA4 strings — JA4_R strings work with no
+// resolver at all since they carry the raw cipher/extension/sigalg lists.
+var ja4Resolver map[string]string
+
+// SetJA4Resolver installs the lookup table used to expand hashed JA4 strings
+// into raw JA4_R strings.
+func SetJA4Resolver(m map[string]string) {
+	ja4Resolver = m
+}
+
+// LoadJA4ResolverFile loads a JSON object of {"<ja4 hash>": "<ja4_r string>"}
+// and installs it via SetJA4Resolver.
+func LoadJA4ResolverFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading JA4 resolver file: %s", err)
+	}
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parsing JA4 resolver file: %s", err)
+	}
+	SetJA4Resolver(m)
+	return nil
+}
+
+// ja4MetadataLen is the length of a JA4 metadata prefix, e.g. "t13d1516h2":
+// protocol(1) + TLS version(2) + SNI(1) + cipher count hex(2) + extension
+// count hex(2) + first ALPN(2).
+const ja4MetadataLen = 10
+
+// ja4Metadata holds the parsed fields of a JA4 metadata prefix.
+type ja4Metadata struct {
+	Protocol byte
+	Version  uint16
+	SNI      byte
+	ALPN     string
+}
+
+// isJA4String reports whether s looks like a JA4 or JA4_R fingerprint: a
+// metadata prefix followed by either two underscore-separated hashes
+// (hashed JA4) or three underscore-separated raw lists (JA4_R: ciphers,
+// extensions, signature algorithms).
+func isJA4String(s string) bool {
+	parts := strings.Split(s, "_")
+	if len(parts) != 3 && len(parts) != 4 {
+		return false
+	}
+	return isJA4MetadataPrefix(parts[0])
+}
+
+// isJA4MetadataPrefix reports whether s has the shape of a JA4 metadata
+// prefix (it doesn't validate the version/ALPN values themselves).
+func isJA4MetadataPrefix(s string) bool {
+	if len(s) != ja4MetadataLen {
+		return false
+	}
+	if s[0] != 't' && s[0] != 'q' {
+		return false
+	}
+	if s[3] != 'd' && s[3] != 'i' {
+		return false
+	}
+	_, err := strconv.ParseUint(s[4:8], 16, 32)
+	return err == nil
+}
+
+// parseJA4Metadata parses a JA4 metadata prefix like "t13d1516h2".
+func parseJA4Metadata(s string) (ja4Metadata, error) {
+	if !isJA4MetadataPrefix(s) {
+		return ja4Metadata{}, fmt.Errorf("invalid JA4 metadata prefix: %q", s)
+	}
+
+	var version uint16
+	switch s[1:3] {
+	case "13":
+		version = tls.VersionTLS13
+	case "12":
+		version = tls.VersionTLS12
+	case "11":
+		version = tls.VersionTLS11
+	case "10":
+		version = tls.VersionTLS10
+	default:
+		return ja4Metadata{}, fmt.Errorf("unsupported JA4 TLS version code: %q", s[1:3])
+	}
+
+	return ja4Metadata{
+		Protocol: s[0],
+		Version:  version,
+		SNI:      s[3],
+		ALPN:     s[8:10],
+	}, nil
+}
+
+// resolveJA4 turns a JA4 or JA4_R string into a ClientHelloSpec. Raw JA4_R
+// strings (4 underscore-separated parts) are reconstructed directly; hashed
+// JA4 strings (3 parts) are looked up in ja4Resolver and rejected with a
+// clear error when no resolver is configured, since a hash alone can't be
+// turned back into cipher/extension lists.
+func resolveJA4(ja4 string) (*tls.ClientHelloSpec, error) {
+	parts := strings.Split(ja4, "_")
+	if len(parts) == 4 {
+		return parseJA4Raw(parts)
+	}
+
+	raw, ok := ja4Resolver[ja4]
+	if !ok {
+		return nil, fmt.Errorf("JA4 %q is a hash and cannot be reconstructed into a ClientHello without a JA4 resolver configured (see SetJA4Resolver/LoadJA4ResolverFile)", ja4)
+	}
+	rawParts := strings.Split(raw, "_")
+	if len(rawParts) != 4 {
+		return nil, fmt.Errorf("JA4 resolver entry for %q is not a valid JA4_R string: %q", ja4, raw)
+	}
+	return parseJA4Raw(rawParts)
+}
+
+// parseJA4Raw builds a ClientHelloSpec from the 4 underscore-separated parts
+// of a JA4_R string: metadata, sorted cipher hex list, sorted extension hex
+// list, sorted signature-algorithm hex list.
+func parseJA4Raw(parts []string) (*tls.ClientHelloSpec, error) {
+	meta, err := parseJA4Metadata(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ciphers, err := parseHexList(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JA4 cipher list: %s", err)
+	}
+
+	extIDs, err := parseHexList(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JA4 extension list: %s", err)
+	}
+
+	sigAlgValues, err := parseHexList(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JA4 signature algorithm list: %s", err)
+	}
+	sigAlgs := make([]tls.SignatureScheme, len(sigAlgValues))
+	for i, v := range sigAlgValues {
+		sigAlgs[i] = tls.SignatureScheme(v)
+	}
+
+	tlsVersMax := meta.Version
+	if tlsVersMax < tls.VersionTLS12 {
+		tlsVersMax = tls.VersionTLS12
+	}
+
+	spec := &tls.ClientHelloSpec{
+		TLSVersMin:         tls.VersionTLS10,
+		TLSVersMax:         tlsVersMax,
+		CipherSuites:       ciphers,
+		CompressionMethods: []uint8{0},
+		Extensions:         buildExtensions(extIDs, nil, nil, sigAlgs),
+	}
+
+	return spec, nil
+}
+
+// parseHexList parses a "," separated list of 16-bit hex values, e.g.
+// "002f,0035,1301". An empty string yields no values.
+func parseHexList(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	result := make([]uint16, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.ParseUint(p, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value %q: %s", p, err)
+		}
+		result = append(result, uint16(n))
+	}
+	return result, nil
+}
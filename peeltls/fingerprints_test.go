@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+func TestIsJA3String(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{"valid ja3", "771,4865-4866-4867,0-23-65281,29-23-24,0", true},
+		{"too few parts", "771,4865", false},
+		{"non-numeric version", "abc,4865,0", false},
+		{"empty", "", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isJA3String(c.in); got != c.want {
+				t.Errorf("isJA3String(%q) = %v, want %v", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestIsJA4String(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want bool
+	}{
+		{"hashed ja4", "t13d1516h2_8daaf6152771_b0d3b4e7fd0b", true},
+		{"raw ja4_r", "t13d1516h2_002f,0035,009c_0000,0017,ff01_0403,0804,0401", true},
+		{"wrong part count", "t13d1516h2_8daaf6152771", false},
+		{"bad metadata prefix", "x13d1516h2_8daaf6152771_b0d3b4e7fd0b", false},
+		{"not ja4 shaped", "chrome-133", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isJA4String(c.in); got != c.want {
+				t.Errorf("isJA4String(%q) = %v, want %v", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseJA4Metadata(t *testing.T) {
+	meta, err := parseJA4Metadata("t13d1516h2")
+	if err != nil {
+		t.Fatalf("parseJA4Metadata returned error: %s", err)
+	}
+	if meta.Protocol != 't' {
+		t.Errorf("Protocol = %q, want 't'", meta.Protocol)
+	}
+	if meta.SNI != 'd' {
+		t.Errorf("SNI = %q, want 'd'", meta.SNI)
+	}
+	if meta.ALPN != "h2" {
+		t.Errorf("ALPN = %q, want \"h2\"", meta.ALPN)
+	}
+
+	if _, err := parseJA4Metadata("bogus"); err == nil {
+		t.Error("parseJA4Metadata(\"bogus\") should have errored")
+	}
+}
+
+func TestParseUint16List(t *testing.T) {
+	got, err := parseUint16List("0-23-65281")
+	if err != nil {
+		t.Fatalf("parseUint16List returned error: %s", err)
+	}
+	want := []uint16{0, 23, 65281}
+	if len(got) != len(want) {
+		t.Fatalf("parseUint16List = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseUint16List[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	if _, err := parseUint16List("0-bad-65281"); err == nil {
+		t.Error("parseUint16List with a non-numeric entry should have errored")
+	}
+}
+
+func TestIsGREASEUint16(t *testing.T) {
+	cases := []struct {
+		v    uint16
+		want bool
+	}{
+		{0x0a0a, true},
+		{0x1a1a, true},
+		{0xfafa, true},
+		{0x0017, false},
+		{0x0023, false},
+	}
+	for _, c := range cases {
+		if got := isGREASEUint16(c.v); got != c.want {
+			t.Errorf("isGREASEUint16(0x%04x) = %v, want %v", c.v, got, c.want)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,21 +23,219 @@ import (
 	"github.com/andybalholm/brotli"
 )
 
-// doHTTP2fhttp performs an HTTP/2 request using fhttp with Chrome fingerprinting.
-// Returns a standard *http.Response so the caller doesn't need to know about fhttp.
-func doHTTP2fhttp(conn net.Conn, parsedURL *url.URL, method string, headers map[string]string) (*http.Response, error) {
-	// Create fhttp HTTP/2 transport with Chrome preset
+// H2FingerprintSpec describes the HTTP/2-layer fingerprint: SETTINGS (in
+// order), the connection-level WINDOW_UPDATE delta sent after the preface,
+// the pseudo-header order, and an optional PRIORITY frame to emit before
+// HEADERS. It's the HTTP/2 analogue of the TLS-layer FingerprintSpec.
+type H2FingerprintSpec struct {
+	Settings          []fhttp2.Setting
+	ConnectionFlow    uint32
+	PseudoHeaderOrder []string
+	Priority          *fhttp2.PriorityParam
+}
+
+// h2Presets maps friendly names to named H2 fingerprint profiles, built from
+// the same SETTINGS/WINDOW_UPDATE/pseudo-header values real clients send.
+var h2Presets = map[string]H2FingerprintSpec{
+	"chrome": {
+		Settings: []fhttp2.Setting{
+			{ID: fhttp2.SettingHeaderTableSize, Val: 65536},
+			{ID: fhttp2.SettingEnablePush, Val: 0},
+			{ID: fhttp2.SettingInitialWindowSize, Val: 6291456},
+			{ID: fhttp2.SettingMaxHeaderListSize, Val: 262144},
+		},
+		ConnectionFlow:    15663105,
+		PseudoHeaderOrder: []string{":method", ":authority", ":scheme", ":path"},
+	},
+	"firefox": {
+		Settings: []fhttp2.Setting{
+			{ID: fhttp2.SettingHeaderTableSize, Val: 65536},
+			{ID: fhttp2.SettingInitialWindowSize, Val: 131072},
+			{ID: fhttp2.SettingMaxFrameSize, Val: 16384},
+		},
+		ConnectionFlow:    12517377,
+		PseudoHeaderOrder: []string{":method", ":path", ":authority", ":scheme"},
+		Priority:          &fhttp2.PriorityParam{Exclusive: false, Weight: 41},
+	},
+	"safari": {
+		Settings: []fhttp2.Setting{
+			{ID: fhttp2.SettingEnablePush, Val: 0},
+			{ID: fhttp2.SettingInitialWindowSize, Val: 2097152},
+			{ID: fhttp2.SettingMaxConcurrentStreams, Val: 100},
+		},
+		ConnectionFlow:    10485760,
+		PseudoHeaderOrder: []string{":method", ":scheme", ":authority", ":path"},
+	},
+	"okhttp": {
+		Settings: []fhttp2.Setting{
+			{ID: fhttp2.SettingMaxConcurrentStreams, Val: 100},
+			{ID: fhttp2.SettingInitialWindowSize, Val: 65535},
+		},
+		ConnectionFlow:    262144,
+		PseudoHeaderOrder: []string{":method", ":authority", ":scheme", ":path"},
+	},
+}
+
+// pseudoHeaderLetters maps the compact-string pseudo-header codes to their
+// wire names: m=:method, a=:authority, s=:scheme, p=:path.
+var pseudoHeaderLetters = map[byte]string{
+	'm': ":method",
+	'a': ":authority",
+	's': ":scheme",
+	'p': ":path",
+}
+
+// resolveH2Fingerprint returns the H2FingerprintSpec for the given name.
+// It checks named presets first, then falls back to parsing a compact
+// string of the form "settings|connFlow|pseudoOrder", e.g.
+// "1:65536,2:0,4:6291456,6:262144|15663105|m,a,s,p". Falls back to the
+// Chrome preset (today's behavior) when fp is empty or unparseable.
+func resolveH2Fingerprint(fp string) H2FingerprintSpec {
+	if fp == "" {
+		return h2Presets["chrome"]
+	}
+	if preset, ok := h2Presets[strings.ToLower(fp)]; ok {
+		return preset
+	}
+	if spec, err := parseH2FingerprintString(fp); err == nil {
+		return *spec
+	}
+	return h2Presets["chrome"]
+}
+
+// parseH2FingerprintString parses the compact "settings|connFlow|pseudoOrder"
+// form into an H2FingerprintSpec. An optional fourth "|weight:streamDep:exclusive"
+// segment carries a PRIORITY frame to send before HEADERS.
+func parseH2FingerprintString(s string) (*H2FingerprintSpec, error) {
+	parts := strings.Split(s, "|")
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("invalid h2 fingerprint string: expected at least 3 '|'-separated parts, got %d", len(parts))
+	}
+
+	settings, err := parseH2Settings(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings: %s", err)
+	}
+
+	connFlow, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection flow: %s", err)
+	}
+
+	order, err := parsePseudoHeaderOrder(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid pseudo-header order: %s", err)
+	}
+
+	spec := &H2FingerprintSpec{
+		Settings:          settings,
+		ConnectionFlow:    uint32(connFlow),
+		PseudoHeaderOrder: order,
+	}
+
+	if len(parts) > 3 && parts[3] != "" {
+		priority, err := parsePriorityParam(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority: %s", err)
+		}
+		spec.Priority = priority
+	}
+
+	return spec, nil
+}
+
+// parseH2Settings parses "id:val,id:val,..." into ordered Settings.
+func parseH2Settings(s string) ([]fhttp2.Setting, error) {
+	pairs := strings.Split(s, ",")
+	settings := make([]fhttp2.Setting, 0, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid setting %q", pair)
+		}
+		id, err := strconv.ParseUint(kv[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid setting id %q: %s", kv[0], err)
+		}
+		val, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid setting value %q: %s", kv[1], err)
+		}
+		settings = append(settings, fhttp2.Setting{ID: fhttp2.SettingID(id), Val: uint32(val)})
+	}
+	return settings, nil
+}
+
+// parsePseudoHeaderOrder parses "m,a,s,p" into the ordered pseudo-header names.
+func parsePseudoHeaderOrder(s string) ([]string, error) {
+	codes := strings.Split(s, ",")
+	order := make([]string, 0, len(codes))
+	for _, code := range codes {
+		code = strings.TrimSpace(code)
+		if len(code) != 1 {
+			return nil, fmt.Errorf("invalid pseudo-header code %q", code)
+		}
+		name, ok := pseudoHeaderLetters[code[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown pseudo-header code %q", code)
+		}
+		order = append(order, name)
+	}
+	return order, nil
+}
+
+// parsePriorityParam parses "weight:streamDep:exclusive" (exclusive as 0/1).
+func parsePriorityParam(s string) (*fhttp2.PriorityParam, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("expected weight:streamDep:exclusive, got %q", s)
+	}
+	weight, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid weight: %s", err)
+	}
+	streamDep, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream dependency: %s", err)
+	}
+	exclusive, err := strconv.ParseBool(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclusive flag: %s", err)
+	}
+	return &fhttp2.PriorityParam{
+		Weight:    uint8(weight),
+		StreamDep: uint32(streamDep),
+		Exclusive: exclusive,
+	}, nil
+}
+
+// newH2ClientConn creates an fhttp HTTP/2 client connection over conn, driven
+// by the given H2 fingerprint. The caller owns conn's lifecycle: close it on
+// error, or keep both around (e.g. in a Session) to reuse the connection.
+func newH2ClientConn(conn net.Conn, h2Fingerprint string) (*fhttp2.ClientConn, H2FingerprintSpec, error) {
+	spec := resolveH2Fingerprint(h2Fingerprint)
+
+	// Create fhttp HTTP/2 transport driven by the resolved fingerprint spec.
 	tr := &fhttp2.Transport{
-		Navigator: fhttp2.Chrome,
+		HTTP2Settings: &fhttp2.HTTP2Settings{
+			Settings:       spec.Settings,
+			ConnectionFlow: int(spec.ConnectionFlow),
+			HeaderPriority: spec.Priority,
+		},
 	}
 
-	// Create HTTP/2 client connection from our existing uTLS connection
 	h2cc, err := tr.NewClientConn(conn)
 	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("h2 client conn failed: %s", err)
+		return nil, H2FingerprintSpec{}, fmt.Errorf("h2 client conn failed: %s", err)
 	}
+	return h2cc, spec, nil
+}
 
+// doHTTP2OnConn builds an fhttp.Request with Chrome-like header ordering and
+// the given pseudo-header order, then executes it on an already-established
+// H2 client connection. It does not touch the underlying net.Conn, so the
+// caller (a one-shot request or a pooled Session) owns its lifecycle.
+func doHTTP2OnConn(h2cc *fhttp2.ClientConn, pHeaderOrder []string, parsedURL *url.URL, method string, headers map[string]string, readTimeout time.Duration, trace *TraceInfo) (*fhttp.Response, error) {
 	// Build the request using fhttp.Request (supports header ordering)
 	req := &fhttp.Request{
 		Method: strings.ToUpper(method),
@@ -47,7 +246,6 @@ func doHTTP2fhttp(conn net.Conn, parsedURL *url.URL, method string, headers map[
 
 	// Set headers with Chrome-like ordering
 	headerOrder := []string{}
-	pHeaderOrder := []string{":method", ":authority", ":scheme", ":path"}
 
 	// Set default Accept-Encoding
 	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
@@ -84,22 +282,28 @@ func doHTTP2fhttp(conn net.Conn, parsedURL *url.URL, method string, headers map[
 	req.Header[fhttp.HeaderOrderKey] = headerOrder
 	req.Header[fhttp.PHeaderOrderKey] = pHeaderOrder
 
-	// Set timeout via context
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Set timeout via context, honoring the caller's configured read budget
+	// instead of a fixed 30s (see Timeouts.Read in fetch.go).
+	ctx, cancel := context.WithTimeout(context.Background(), readTimeout)
 	defer cancel()
 	req = req.WithContext(ctx)
 
-	// Execute request
+	traceHTTP2Request(trace, req)
+
 	resp, err := h2cc.RoundTrip(req)
 	if err != nil {
-		conn.Close()
 		return nil, fmt.Errorf("h2 request failed: %s", err)
 	}
+	return resp, nil
+}
 
-	// Read and decompress body
+// readH2Response reads and decompresses an fhttp.Response's body and
+// converts it to a standard *http.Response, closing resp.Body but leaving
+// the underlying connection untouched.
+func readH2Response(resp *fhttp.Response, trace *TraceInfo) (*http.Response, error) {
+	traceHTTP2Response(trace, resp)
 	bodyBytes, err := io.ReadAll(resp.Body)
 	resp.Body.Close()
-	conn.Close()
 	if err != nil {
 		return nil, fmt.Errorf("h2 body read failed: %s", err)
 	}
@@ -116,7 +320,6 @@ func doHTTP2fhttp(conn net.Conn, parsedURL *url.URL, method string, headers map[
 		stdHeaders[k] = vs
 	}
 
-	// Return as standard http.Response
 	return &http.Response{
 		StatusCode:    resp.StatusCode,
 		Status:        resp.Status,
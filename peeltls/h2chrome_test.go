@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestParseH2FingerprintString(t *testing.T) {
+	spec, err := parseH2FingerprintString("1:65536,3:1000,4:6291456|15663105|m,a,s,p")
+	if err != nil {
+		t.Fatalf("parseH2FingerprintString returned error: %s", err)
+	}
+	if len(spec.Settings) != 3 {
+		t.Fatalf("Settings = %v, want 3 entries", spec.Settings)
+	}
+	if spec.Settings[0].ID != 1 || spec.Settings[0].Val != 65536 {
+		t.Errorf("Settings[0] = %+v, want {ID:1 Val:65536}", spec.Settings[0])
+	}
+	if spec.ConnectionFlow != 15663105 {
+		t.Errorf("ConnectionFlow = %d, want 15663105", spec.ConnectionFlow)
+	}
+	want := []string{":method", ":authority", ":scheme", ":path"}
+	if len(spec.PseudoHeaderOrder) != len(want) {
+		t.Fatalf("PseudoHeaderOrder = %v, want %v", spec.PseudoHeaderOrder, want)
+	}
+	for i := range want {
+		if spec.PseudoHeaderOrder[i] != want[i] {
+			t.Errorf("PseudoHeaderOrder[%d] = %q, want %q", i, spec.PseudoHeaderOrder[i], want[i])
+		}
+	}
+	if spec.Priority != nil {
+		t.Errorf("Priority = %+v, want nil (no 4th segment)", spec.Priority)
+	}
+}
+
+func TestParseH2FingerprintStringWithPriority(t *testing.T) {
+	spec, err := parseH2FingerprintString("1:65536|15663105|m,a,s,p|255:0:true")
+	if err != nil {
+		t.Fatalf("parseH2FingerprintString returned error: %s", err)
+	}
+	if spec.Priority == nil {
+		t.Fatal("Priority = nil, want a parsed PriorityParam")
+	}
+	if spec.Priority.Weight != 255 || !spec.Priority.Exclusive {
+		t.Errorf("Priority = %+v, want {Weight:255 StreamDep:0 Exclusive:true}", spec.Priority)
+	}
+}
+
+func TestParseH2FingerprintStringInvalid(t *testing.T) {
+	cases := []string{
+		"",
+		"1:65536|15663105",             // missing pseudo-header order segment
+		"bad|15663105|m,a,s,p",         // malformed settings
+		"1:65536|not-a-number|m,a,s,p", // malformed connection flow
+		"1:65536|15663105|m,a,s,x",     // unknown pseudo-header code
+	}
+	for _, c := range cases {
+		if _, err := parseH2FingerprintString(c); err == nil {
+			t.Errorf("parseH2FingerprintString(%q) should have errored", c)
+		}
+	}
+}
+
+func TestResolveH2FingerprintFallsBackOnGarbage(t *testing.T) {
+	spec := resolveH2Fingerprint("not a valid fingerprint at all")
+	chrome := h2Presets["chrome"]
+	if len(spec.Settings) != len(chrome.Settings) {
+		t.Errorf("resolveH2Fingerprint with garbage input didn't fall back to the chrome preset")
+	}
+}
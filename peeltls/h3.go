@@ -0,0 +1,301 @@
+package main
+
+// HTTP/3 client using uquic (a uTLS-aware fork of quic-go) so the QUIC
+// Initial packet's ClientHello is driven by the same FingerprintSpec
+// machinery as the TLS and HTTP/2 paths, instead of quic-go's stock Go
+// crypto/tls handshake.
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	quic "github.com/refraction-networking/uquic"
+	qhttp3 "github.com/refraction-networking/uquic/http3"
+	tls "github.com/refraction-networking/utls"
+)
+
+// quicPresets maps friendly names to uquic's built-in QUIC parrots. Each
+// parrot pins both the Initial packet shape (conn ID lengths, frame
+// padding) and the ClientHello's quic_transport_parameters extension, so
+// picking one fixes the whole QUIC-layer fingerprint in one step.
+var quicPresets = map[string]quic.QUICID{
+	"chrome":  quic.QUICChrome_115,
+	"firefox": quic.QUICFirefox_116,
+}
+
+// quicTransportParamIDs are the RFC 9000 transport-parameter IDs callers may
+// override via the compact QUIC fingerprint string, named the same way the
+// H2 SETTINGS profile names its SETTINGS IDs.
+const (
+	tpInitialMaxData          uint64 = 0x4
+	tpInitialMaxStreamsBidi   uint64 = 0x8
+	tpActiveConnectionIDLimit uint64 = 0xe
+)
+
+// resolveQUICFingerprint returns the QUICSpec for the given fingerprint
+// name. It checks named presets first ("chrome", "firefox"), then falls
+// back to parsing a compact override string of the form
+// "id:val,id:val|id,id,..." that tweaks specific transport parameters
+// and/or their order on top of the Chrome preset. Falls back to the
+// Chrome preset when fp is empty or unparseable, mirroring resolveFingerprint.
+func resolveQUICFingerprint(fp string) (quic.QUICSpec, error) {
+	if fp == "" {
+		return quic.QUICID2Spec(quic.QUICChrome_115)
+	}
+	if id, ok := quicPresets[strings.ToLower(fp)]; ok {
+		return quic.QUICID2Spec(id)
+	}
+	if spec, err := parseQUICFingerprintString(fp); err == nil {
+		return *spec, nil
+	}
+	return quic.QUICID2Spec(quic.QUICChrome_115)
+}
+
+// parseQUICFingerprintString parses "id:val,id:val|id,id,..." (overrides,
+// then an optional reordering of transport-parameter IDs) and applies it to
+// a copy of the Chrome preset's QUICSpec.
+func parseQUICFingerprintString(s string) (*quic.QUICSpec, error) {
+	parts := strings.SplitN(s, "|", 2)
+
+	overrides, err := parseUint64Pairs(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid transport parameter overrides: %s", err)
+	}
+
+	var order []uint64
+	if len(parts) > 1 && parts[1] != "" {
+		order, err = parseUint64List(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid transport parameter order: %s", err)
+		}
+	}
+
+	spec, err := quic.QUICID2Spec(quic.QUICChrome_115)
+	if err != nil {
+		return nil, err
+	}
+
+	qtp, err := findQUICTransportParametersExtension(spec.ClientHelloSpec)
+	if err != nil {
+		return nil, err
+	}
+	applyQUICTransportParamOverrides(qtp, overrides)
+	if order != nil {
+		reorderQUICTransportParams(qtp, order)
+	}
+
+	return &spec, nil
+}
+
+// findQUICTransportParametersExtension locates the quic_transport_parameters
+// extension within a ClientHelloSpec built from a uquic parrot.
+func findQUICTransportParametersExtension(chs *tls.ClientHelloSpec) (*tls.QUICTransportParametersExtension, error) {
+	for _, ext := range chs.Extensions {
+		if qtp, ok := ext.(*tls.QUICTransportParametersExtension); ok {
+			return qtp, nil
+		}
+	}
+	return nil, fmt.Errorf("QUIC parrot has no quic_transport_parameters extension")
+}
+
+// applyQUICTransportParamOverrides replaces the value of any transport
+// parameter present in overrides (keyed by RFC 9000 transport-parameter ID),
+// leaving parameters not mentioned untouched.
+func applyQUICTransportParamOverrides(qtp *tls.QUICTransportParametersExtension, overrides map[uint64]uint64) {
+	for i, tp := range qtp.TransportParameters {
+		if val, ok := overrides[tp.ID()]; ok {
+			switch tp.ID() {
+			case tpInitialMaxData:
+				qtp.TransportParameters[i] = tls.InitialMaxData(val)
+			case tpInitialMaxStreamsBidi:
+				qtp.TransportParameters[i] = tls.InitialMaxStreamsBidi(val)
+			case tpActiveConnectionIDLimit:
+				qtp.TransportParameters[i] = tls.ActiveConnectionIDLimit(val)
+			}
+		}
+	}
+}
+
+// reorderQUICTransportParams sorts the parameters named in order to the
+// front, in the order given, followed by any remaining parameters in their
+// original relative order — anti-bot vendors fingerprint this ordering the
+// same way they do HTTP/2 SETTINGS order.
+func reorderQUICTransportParams(qtp *tls.QUICTransportParametersExtension, order []uint64) {
+	rank := make(map[uint64]int, len(order))
+	for i, id := range order {
+		rank[id] = i
+	}
+
+	ordered := make([]tls.TransportParameter, 0, len(qtp.TransportParameters))
+	var rest []tls.TransportParameter
+	for _, id := range order {
+		for _, tp := range qtp.TransportParameters {
+			if tp.ID() == id {
+				ordered = append(ordered, tp)
+			}
+		}
+	}
+	for _, tp := range qtp.TransportParameters {
+		if _, ranked := rank[tp.ID()]; !ranked {
+			rest = append(rest, tp)
+		}
+	}
+	qtp.TransportParameters = append(ordered, rest...)
+}
+
+// applyTLSFingerprintToQUICSpec substitutes custom's CipherSuites,
+// CompressionMethods and Extensions into spec's ClientHelloSpec, so a
+// JA3/JA4 fingerprint resolved for the H1/H2 paths drives the TLS
+// ClientHello inside the QUIC Initial packet too. custom never carries a
+// quic_transport_parameters extension (JA3/JA4 describe a TCP-TLS
+// handshake), so that extension is carried over from spec's own parrot
+// ClientHelloSpec to keep the QUIC transport-parameter fingerprint from
+// resolveQUICFingerprint intact.
+func applyTLSFingerprintToQUICSpec(spec *quic.QUICSpec, custom *tls.ClientHelloSpec) error {
+	qtp, err := findQUICTransportParametersExtension(spec.ClientHelloSpec)
+	if err != nil {
+		return err
+	}
+
+	merged := *custom
+	merged.Extensions = append(append([]tls.TLSExtension{}, custom.Extensions...), qtp)
+	spec.ClientHelloSpec = &merged
+	return nil
+}
+
+// parseUint64Pairs parses "id:val,id:val" into a map.
+func parseUint64Pairs(s string) (map[uint64]uint64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	result := make(map[uint64]uint64)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid pair %q", pair)
+		}
+		id, err := strconv.ParseUint(kv[0], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %s", kv[0], err)
+		}
+		val, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q: %s", kv[1], err)
+		}
+		result[id] = val
+	}
+	return result, nil
+}
+
+// parseUint64List parses "id,id,id".
+func parseUint64List(s string) ([]uint64, error) {
+	fields := strings.Split(s, ",")
+	result := make([]uint64, 0, len(fields))
+	for _, f := range fields {
+		id, err := strconv.ParseUint(f, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %s", f, err)
+		}
+		result = append(result, id)
+	}
+	return result, nil
+}
+
+// doHTTP3 performs a request over HTTP/3 (QUIC), using quicFingerprint to
+// drive the QUIC Initial packet's transport parameters and tlsFingerprint
+// (the same JA3/JA4/preset spec the H1/H2 paths use) to drive the TLS
+// ClientHello carried inside it. Proxying is relayed over a single hop, via
+// SOCKS5 UDP ASSOCIATE (RFC 1928) or HTTP CONNECT-UDP (RFC 9298) — see
+// dialProxyUDP — since proxy chaining isn't meaningful for either (each hop
+// would need its own relay); any other proxy scheme is rejected with a
+// clear error instead of silently falling back to a TCP path that would
+// defeat the point of H3.
+func doHTTP3(rawURL, method string, headers map[string]string, tlsFingerprint, quicFingerprint string, proxy ProxyChain, timeouts Timeouts, timing *FetchTiming) (*http.Response, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %s", err)
+	}
+
+	quicSpec, err := resolveQUICFingerprint(quicFingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("quic fingerprint resolution failed: %s", err)
+	}
+
+	fpSpec, err := resolveFingerprint(tlsFingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("tls fingerprint resolution failed: %s", err)
+	}
+	if fpSpec.CustomSpec != nil {
+		if err := applyTLSFingerprintToQUICSpec(&quicSpec, fpSpec.CustomSpec); err != nil {
+			return nil, fmt.Errorf("applying tls fingerprint to quic ClientHello: %s", err)
+		}
+	}
+
+	var uTransport *quic.UTransport
+	if len(proxy) > 0 {
+		port := parsedURL.Port()
+		if port == "" {
+			port = "443"
+		}
+		targetAddr := net.JoinHostPort(parsedURL.Hostname(), port)
+
+		udpConn, err := dialProxyUDP(proxy, targetAddr, timeouts.Dial, timeouts.Keepalive)
+		if err != nil {
+			return nil, fmt.Errorf("h3 proxy dial failed: %s", err)
+		}
+		uTransport = &quic.UTransport{
+			Transport: &quic.Transport{Conn: udpConn},
+			QUICSpec:  &quicSpec,
+		}
+	}
+
+	tlsStart := time.Now()
+	roundTripper := &qhttp3.RoundTripper{
+		TLSClientConfig: &tls.Config{
+			ServerName: parsedURL.Hostname(),
+			NextProtos: []string{"h3"},
+		},
+		QuicConfig: &quic.Config{},
+	}
+	uRoundTripper := qhttp3.GetURoundTripper(roundTripper, &quicSpec, uTransport)
+	defer uRoundTripper.Close()
+
+	req, err := buildHTTPRequest(method, parsedURL, headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %s", err)
+	}
+
+	// QUIC combines the transport dial and TLS handshake into one round
+	// trip, so there's no separate phase to hang a TLS-only deadline off —
+	// budget the connect as dial+TLS combined.
+	ctx, cancel := context.WithTimeout(context.Background(), timeouts.Dial+timeouts.TLS)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	resp, err := uRoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("h3 request failed: %s", err)
+	}
+	timing.TLSMS = time.Since(tlsStart).Milliseconds()
+
+	return resp, nil
+}
+
+// altSvcAdvertisesH3 reports whether an Alt-Svc header value offers h3, so
+// doFetch can upgrade a protocol:"auto" request after its first H1/H2
+// response.
+func altSvcAdvertisesH3(altSvc string) bool {
+	for _, entry := range strings.Split(altSvc, ",") {
+		entry = strings.TrimSpace(entry)
+		if strings.HasPrefix(entry, "h3=") || strings.HasPrefix(entry, "h3-") {
+			return true
+		}
+	}
+	return false
+}
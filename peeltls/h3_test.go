@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	tls "github.com/refraction-networking/utls"
+)
+
+func TestParseUint64Pairs(t *testing.T) {
+	got, err := parseUint64Pairs("0x1:100,0x2:200")
+	if err != nil {
+		t.Fatalf("parseUint64Pairs returned error: %s", err)
+	}
+	if got[1] != 100 || got[2] != 200 {
+		t.Errorf("parseUint64Pairs = %v, want {1:100, 2:200}", got)
+	}
+
+	if got, err := parseUint64Pairs(""); err != nil || got != nil {
+		t.Errorf("parseUint64Pairs(\"\") = %v, %v, want nil, nil", got, err)
+	}
+
+	if _, err := parseUint64Pairs("0x1"); err == nil {
+		t.Error("parseUint64Pairs(\"0x1\") should have errored (missing value)")
+	}
+	if _, err := parseUint64Pairs("0x1:bad"); err == nil {
+		t.Error("parseUint64Pairs(\"0x1:bad\") should have errored (non-numeric value)")
+	}
+}
+
+func TestParseUint64List(t *testing.T) {
+	got, err := parseUint64List("0x1,0x2,0x3")
+	if err != nil {
+		t.Fatalf("parseUint64List returned error: %s", err)
+	}
+	want := []uint64{1, 2, 3}
+	if len(got) != len(want) {
+		t.Fatalf("parseUint64List = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseUint64List[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	if _, err := parseUint64List("0x1,bad"); err == nil {
+		t.Error("parseUint64List with a non-numeric entry should have errored")
+	}
+}
+
+// TestApplyTLSFingerprintToQUICSpec guards against regressing the H3 path
+// ignoring req.Fingerprint entirely: the resolved JA3/JA4 ClientHelloSpec
+// must drive the QUIC Initial packet's ClientHello, while the
+// quic_transport_parameters extension from the QUIC parrot (required by
+// uquic) must survive the merge.
+func TestApplyTLSFingerprintToQUICSpec(t *testing.T) {
+	spec, err := resolveQUICFingerprint("chrome")
+	if err != nil {
+		t.Fatalf("resolveQUICFingerprint returned error: %s", err)
+	}
+
+	custom := &tls.ClientHelloSpec{
+		CipherSuites: []uint16{0x1301, 0x1302},
+		Extensions:   []tls.TLSExtension{&tls.SNIExtension{}},
+	}
+
+	if err := applyTLSFingerprintToQUICSpec(&spec, custom); err != nil {
+		t.Fatalf("applyTLSFingerprintToQUICSpec returned error: %s", err)
+	}
+
+	if len(spec.ClientHelloSpec.CipherSuites) != 2 || spec.ClientHelloSpec.CipherSuites[0] != 0x1301 {
+		t.Errorf("CipherSuites = %v, want the custom spec's ciphers", spec.ClientHelloSpec.CipherSuites)
+	}
+
+	if _, err := findQUICTransportParametersExtension(spec.ClientHelloSpec); err != nil {
+		t.Errorf("merged ClientHelloSpec lost its quic_transport_parameters extension: %s", err)
+	}
+
+	foundSNI := false
+	for _, ext := range spec.ClientHelloSpec.Extensions {
+		if _, ok := ext.(*tls.SNIExtension); ok {
+			foundSNI = true
+		}
+	}
+	if !foundSNI {
+		t.Error("merged ClientHelloSpec lost the custom spec's SNIExtension")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"sync/atomic"
 	"time"
 )
@@ -22,12 +23,35 @@ var (
 func main() {
 	port := flag.Int("port", 8787, "Port to listen on (0 = random)")
 	token := flag.String("token", "", "Authorization token")
+	poolMaxIdlePerHost := flag.Int("pool-max-idle-per-host", poolDefaultMaxIdlePerHost, "Max idle pooled HTTP/1.1 connections per (scheme, host, fingerprint, proxy)")
+	poolMaxIdleTotal := flag.Int("pool-max-idle-total", poolDefaultMaxIdleTotal, "Max idle pooled HTTP/1.1 connections across all hosts")
+	poolIdleTimeoutSec := flag.Int("pool-idle-timeout", int(poolIdleTimeout/time.Second), "Seconds an idle pooled connection may sit before eviction")
+	skipVerifyHosts := flag.String("insecure-skip-verify-hosts", "", "Comma-separated hostnames (or \"*\") allowed to set insecureSkipVerify in /fetch requests")
+	bindAddress := flag.String("bind-address", "", "Local IP address every outbound dial (proxy hops and targets alike) binds to")
+	ja4ResolverFile := flag.String("ja4-resolver-file", "", "Path to a JSON {hashed JA4: raw JA4_R} file, letting /fetch requests use a bare hashed JA4 as a fingerprint")
 	flag.Parse()
 
 	if *token == "" {
 		log.Fatal("--token is required")
 	}
 
+	configurePool(*poolMaxIdlePerHost, *poolMaxIdleTotal, time.Duration(*poolIdleTimeoutSec)*time.Second)
+	if *skipVerifyHosts != "" {
+		SetAllowedSkipVerifyHosts(strings.Split(*skipVerifyHosts, ","))
+	}
+	if *bindAddress != "" {
+		ip := net.ParseIP(*bindAddress)
+		if ip == nil {
+			log.Fatalf("--bind-address %q is not a valid IP address", *bindAddress)
+		}
+		SetModifyDialer(bindAddressDialer(ip))
+	}
+	if *ja4ResolverFile != "" {
+		if err := LoadJA4ResolverFile(*ja4ResolverFile); err != nil {
+			log.Fatalf("--ja4-resolver-file: %s", err)
+		}
+	}
+
 	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", *port))
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
@@ -38,6 +62,14 @@ func main() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/fetch", authMiddleware(*token, handleFetch))
 	mux.HandleFunc("/health", authMiddleware(*token, handleHealth))
+	mux.HandleFunc("/session/create", authMiddleware(*token, handleSessionCreate))
+	mux.HandleFunc("/session/close", authMiddleware(*token, handleSessionClose))
+	mux.HandleFunc("/session/list", authMiddleware(*token, handleSessionList))
+	mux.HandleFunc("POST /session", authMiddleware(*token, handleSessionCreate))
+	mux.HandleFunc("DELETE /session/{id}", authMiddleware(*token, handleSessionDelete))
+	mux.HandleFunc("GET /session/{id}/cookies", authMiddleware(*token, handleSessionCookiesGet))
+	mux.HandleFunc("POST /session/{id}/cookies", authMiddleware(*token, handleSessionCookiesImport))
+	mux.HandleFunc("/pool/stats", authMiddleware(*token, handlePoolStats))
 	mux.HandleFunc("/shutdown", authMiddleware(*token, func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -113,6 +145,142 @@ func handleFetch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Stream {
+		doFetchStream(req, w)
+		return
+	}
+
 	result := doFetch(req)
 	json.NewEncoder(w).Encode(result)
 }
+
+func handleSessionCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid request body: " + err.Error()})
+		return
+	}
+
+	s, err := sessions.create(req)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"sessionId": s.ID})
+}
+
+func handleSessionClose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid request body: " + err.Error()})
+		return
+	}
+
+	if !sessions.closeSession(req.SessionID) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unknown session"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"status": "closed"})
+}
+
+func handleSessionList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string][]SessionInfo{"sessions": sessions.list()})
+}
+
+// handleSessionDelete is the REST-style counterpart to /session/close,
+// addressing the session by path segment instead of a JSON body.
+func handleSessionDelete(w http.ResponseWriter, r *http.Request) {
+	if !sessions.closeSession(r.PathValue("id")) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unknown session"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "closed"})
+}
+
+// handleSessionCookiesGet lists a session's cookies as JSON, or as a
+// Netscape cookie file when called as ?format=netscape, so scraping
+// pipelines can export a session's cookies for reuse elsewhere.
+func handleSessionCookiesGet(w http.ResponseWriter, r *http.Request) {
+	s, ok := sessions.get(r.PathValue("id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unknown session"})
+		return
+	}
+
+	cookies := s.listCookies()
+	if r.URL.Query().Get("format") == "netscape" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(formatNetscapeCookies(cookies))
+		return
+	}
+
+	infos := make([]CookieInfo, 0, len(cookies))
+	for _, c := range cookies {
+		infos = append(infos, CookieInfo{
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Name:     c.Name,
+			Value:    c.Value,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HTTPOnly: c.HTTPOnly,
+		})
+	}
+	json.NewEncoder(w).Encode(map[string][]CookieInfo{"cookies": infos})
+}
+
+// handleSessionCookiesImport seeds a session's jar from a Netscape cookie
+// file in the request body, so a scraping pipeline can carry a cookie jar
+// exported from a real browser into a session before fetching.
+func handleSessionCookiesImport(w http.ResponseWriter, r *http.Request) {
+	s, ok := sessions.get(r.PathValue("id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unknown session"})
+		return
+	}
+
+	cookies, err := parseNetscapeCookies(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	s.importCookies(cookies)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "imported", "count": len(cookies)})
+}
+
+func handlePoolStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(pool.stats())
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fhttp2 "github.com/Danny-Dasilva/fhttp/http2"
+)
+
+// poolIdleTimeout is the default time an idle pooled connection may sit
+// unused before the sweeper closes it, absent a --pool-idle-timeout flag.
+const poolIdleTimeout = 90 * time.Second
+
+// poolSweepInterval is how often the sweeper scans for idle H1 connections
+// past their idle timeout.
+const poolSweepInterval = 30 * time.Second
+
+// poolDefaultMaxIdlePerHost / poolDefaultMaxIdleTotal bound the HTTP/1.1
+// idle pool absent --pool-max-idle-per-host / --pool-max-idle-total flags,
+// mirroring net/http's own defaults for MaxIdleConnsPerHost.
+const (
+	poolDefaultMaxIdlePerHost = 2
+	poolDefaultMaxIdleTotal   = 100
+)
+
+// poolKey identifies a family of interchangeable connections: two
+// session-less fetches only share a connection when the scheme, target
+// address, TLS fingerprint, H2 fingerprint, and proxy chain all match, since
+// any of those changes what's actually negotiated on the wire — H2Fingerprint
+// included, since a connection's SETTINGS/WINDOW_UPDATE are negotiated once
+// at connect time and can't be changed out from under a pooled conn. Modeled
+// on git-lfs's hostClients map (keyed by host+access mode), generalized to
+// the fingerprint/proxy axes this module fingerprints on.
+type poolKey struct {
+	scheme        string
+	addr          string
+	fingerprint   string
+	h2Fingerprint string
+	proxy         string
+}
+
+func newPoolKey(scheme, addr, fingerprint, h2Fingerprint string, proxy ProxyChain) poolKey {
+	return poolKey{scheme: scheme, addr: addr, fingerprint: fingerprint, h2Fingerprint: h2Fingerprint, proxy: proxy.key()}
+}
+
+// idleH1Conn is one pooled, currently-unused HTTP/1.1 connection.
+type idleH1Conn struct {
+	conn     net.Conn
+	lastUsed time.Time
+}
+
+// connPool is the process-wide pool of idle HTTP/1.1 connections and
+// multiplexed HTTP/2 client connections shared by session-less fetches, so
+// repeated requests to the same host skip DNS/dial/TLS. A Session keeps its
+// own isolated H2 pool (see session.go) since a session's cookies and
+// connections are meant to stay scoped to it rather than shared process-wide.
+type connPool struct {
+	maxIdlePerHost int
+	maxIdleTotal   int
+	idleTimeout    time.Duration
+
+	mu          sync.Mutex
+	h1Idle      map[poolKey][]*idleH1Conn
+	h1IdleCount int
+	h2Conns     map[poolKey]*fhttp2.ClientConn
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// pool is the shared pool used by every session-less /fetch. It starts with
+// package defaults and is replaced once at startup by configurePool once
+// flags are parsed.
+var pool = newConnPool(poolDefaultMaxIdlePerHost, poolDefaultMaxIdleTotal, poolIdleTimeout)
+
+func newConnPool(maxIdlePerHost, maxIdleTotal int, idleTimeout time.Duration) *connPool {
+	p := &connPool{
+		maxIdlePerHost: maxIdlePerHost,
+		maxIdleTotal:   maxIdleTotal,
+		idleTimeout:    idleTimeout,
+		h1Idle:         make(map[poolKey][]*idleH1Conn),
+		h2Conns:        make(map[poolKey]*fhttp2.ClientConn),
+	}
+	go p.sweepLoop()
+	return p
+}
+
+// configurePool replaces the global pool with one using the given limits,
+// called once at startup after flags are parsed. Connections already idle
+// in the old pool are closed rather than carried over, since this always
+// runs before the server starts accepting connections.
+func configurePool(maxIdlePerHost, maxIdleTotal int, idleTimeout time.Duration) {
+	old := pool
+	old.mu.Lock()
+	for _, conns := range old.h1Idle {
+		for _, c := range conns {
+			c.conn.Close()
+		}
+	}
+	old.mu.Unlock()
+	pool = newConnPool(maxIdlePerHost, maxIdleTotal, idleTimeout)
+}
+
+// getH1 pops and returns an idle connection for key, or nil on a miss. A
+// returned conn is already removed from the pool — the caller reuses it
+// immediately and must call putH1 or dropH1 afterward.
+func (p *connPool) getH1(key poolKey) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idle := p.h1Idle[key]
+	for len(idle) > 0 {
+		last := idle[len(idle)-1]
+		idle = idle[:len(idle)-1]
+		p.h1IdleCount--
+		if time.Since(last.lastUsed) > p.idleTimeout {
+			last.conn.Close()
+			atomic.AddInt64(&p.evictions, 1)
+			continue
+		}
+		p.h1Idle[key] = idle
+		atomic.AddInt64(&p.hits, 1)
+		return last.conn
+	}
+	p.h1Idle[key] = idle
+	atomic.AddInt64(&p.misses, 1)
+	return nil
+}
+
+// putH1 returns a still-usable HTTP/1.1 connection to the pool for key,
+// evicting the oldest idle connection for this host (or, failing that, the
+// globally oldest) if that would exceed maxIdlePerHost/maxIdleTotal.
+func (p *connPool) putH1(key poolKey, conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idle := p.h1Idle[key]
+	if len(idle) >= p.maxIdlePerHost {
+		idle[0].conn.Close()
+		idle = idle[1:]
+		p.h1IdleCount--
+		atomic.AddInt64(&p.evictions, 1)
+	}
+	for p.h1IdleCount >= p.maxIdleTotal && p.evictOldestLocked() {
+	}
+
+	p.h1Idle[key] = append(idle, &idleH1Conn{conn: conn, lastUsed: time.Now()})
+	p.h1IdleCount++
+}
+
+// evictOldestLocked closes and removes the globally least-recently-used
+// idle H1 connection, reporting whether one was found. Caller holds p.mu.
+func (p *connPool) evictOldestLocked() bool {
+	var oldestKey poolKey
+	oldestIdx := -1
+	var oldestTime time.Time
+	for k, conns := range p.h1Idle {
+		for i, c := range conns {
+			if oldestIdx == -1 || c.lastUsed.Before(oldestTime) {
+				oldestKey, oldestIdx, oldestTime = k, i, c.lastUsed
+			}
+		}
+	}
+	if oldestIdx == -1 {
+		return false
+	}
+	conns := p.h1Idle[oldestKey]
+	conns[oldestIdx].conn.Close()
+	p.h1Idle[oldestKey] = append(conns[:oldestIdx], conns[oldestIdx+1:]...)
+	p.h1IdleCount--
+	atomic.AddInt64(&p.evictions, 1)
+	return true
+}
+
+// dropH1 discards a connection that errored mid-use instead of returning it
+// to the pool, so a half-broken socket doesn't get handed to the next caller.
+func (p *connPool) dropH1(conn net.Conn) {
+	atomic.AddInt64(&p.evictions, 1)
+	conn.Close()
+}
+
+// getH2 returns a still-usable multiplexed H2 connection for key, if any.
+// Unlike H1, an H2 connection is never "checked out" — callers issue
+// concurrent requests directly on it, and it's only removed on error,
+// eviction, or replacement.
+func (p *connPool) getH2(key poolKey) *fhttp2.ClientConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cc, ok := p.h2Conns[key]
+	if !ok {
+		atomic.AddInt64(&p.misses, 1)
+		return nil
+	}
+	if !cc.CanTakeNewRequest() {
+		delete(p.h2Conns, key)
+		atomic.AddInt64(&p.evictions, 1)
+		return nil
+	}
+	atomic.AddInt64(&p.hits, 1)
+	return cc
+}
+
+// putH2 stores a freshly-dialed H2 connection for key, closing whatever
+// (now-stale) connection was already there.
+func (p *connPool) putH2(key poolKey, cc *fhttp2.ClientConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.h2Conns[key]; ok {
+		old.Close()
+	}
+	p.h2Conns[key] = cc
+}
+
+// dropH2 discards an H2 connection that errored mid-use.
+func (p *connPool) dropH2(key poolKey) {
+	p.mu.Lock()
+	cc, ok := p.h2Conns[key]
+	if ok {
+		delete(p.h2Conns, key)
+	}
+	p.mu.Unlock()
+	if ok {
+		cc.Close()
+		atomic.AddInt64(&p.evictions, 1)
+	}
+}
+
+// PoolStats is the JSON-safe snapshot of pool counters returned by
+// /pool/stats.
+type PoolStats struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Evictions   int64 `json:"evictions"`
+	IdleH1Conns int   `json:"idleH1Conns"`
+	PooledH2    int   `json:"pooledH2Conns"`
+}
+
+func (p *connPool) stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PoolStats{
+		Hits:        atomic.LoadInt64(&p.hits),
+		Misses:      atomic.LoadInt64(&p.misses),
+		Evictions:   atomic.LoadInt64(&p.evictions),
+		IdleH1Conns: p.h1IdleCount,
+		PooledH2:    len(p.h2Conns),
+	}
+}
+
+// sweepLoop periodically closes idle H1 connections past idleTimeout, so a
+// host that goes quiet doesn't hold sockets open forever.
+func (p *connPool) sweepLoop() {
+	ticker := time.NewTicker(poolSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		p.sweepIdle()
+	}
+}
+
+func (p *connPool) sweepIdle() {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, conns := range p.h1Idle {
+		fresh := conns[:0]
+		for _, c := range conns {
+			if now.Sub(c.lastUsed) > p.idleTimeout {
+				c.conn.Close()
+				p.h1IdleCount--
+				atomic.AddInt64(&p.evictions, 1)
+				continue
+			}
+			fresh = append(fresh, c)
+		}
+		if len(fresh) == 0 {
+			delete(p.h1Idle, key)
+		} else {
+			p.h1Idle[key] = fresh
+		}
+	}
+}
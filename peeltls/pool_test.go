@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+// TestNewPoolKeyDistinguishesH2Fingerprint guards against regressing the
+// bug where two fetches to the same host with different http2Fingerprint
+// values shared a pooled *fhttp2.ClientConn, silently applying the wrong
+// connection's SETTINGS to the newer fingerprint's header order.
+func TestNewPoolKeyDistinguishesH2Fingerprint(t *testing.T) {
+	a := newPoolKey("https", "example.com:443", "chrome-133", "chrome", ProxyChain{})
+	b := newPoolKey("https", "example.com:443", "chrome-133", "firefox", ProxyChain{})
+	if a == b {
+		t.Errorf("newPoolKey produced identical keys for different h2Fingerprint values: %+v", a)
+	}
+}
+
+func TestNewPoolKeyMatchesOnIdenticalInputs(t *testing.T) {
+	a := newPoolKey("https", "example.com:443", "chrome-133", "chrome", ProxyChain{})
+	b := newPoolKey("https", "example.com:443", "chrome-133", "chrome", ProxyChain{})
+	if a != b {
+		t.Errorf("newPoolKey produced different keys for identical inputs: %+v vs %+v", a, b)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// newTestSocks5UDPPair sets up a socks5UDPConn talking to a plain UDP socket
+// standing in for the proxy's relay, without running a real SOCKS5
+// ASSOCIATE handshake.
+func newTestSocks5UDPPair(t *testing.T) (c *socks5UDPConn, relay *net.UDPConn) {
+	t.Helper()
+
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen relay: %s", err)
+	}
+	t.Cleanup(func() { relay.Close() })
+
+	udpConn, err := net.DialUDP("udp", nil, relay.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("dial relay: %s", err)
+	}
+	t.Cleanup(func() { udpConn.Close() })
+
+	return &socks5UDPConn{UDPConn: udpConn, relayAddr: relay.LocalAddr().(*net.UDPAddr)}, relay
+}
+
+// TestSocks5UDPConnReadFrom guards against regressing a one-byte offset bug:
+// the RFC 1928 UDP header is RSV(2)+FRAG(1)+ATYP(1) = 4 bytes before the
+// address, so the address/payload must be read starting at byte 4, not 3.
+func TestSocks5UDPConnReadFrom(t *testing.T) {
+	c, relay := newTestSocks5UDPPair(t)
+
+	header := []byte{0x00, 0x00, 0x00, socks5AddrIPv4, 1, 2, 3, 4, 0x27, 0x0f} // 1.2.3.4:9999
+	datagram := append(append([]byte{}, header...), []byte("payload")...)
+
+	clientAddr := c.UDPConn.LocalAddr().(*net.UDPAddr)
+	if _, err := relay.WriteToUDP(datagram, clientAddr); err != nil {
+		t.Fatalf("write datagram: %s", err)
+	}
+
+	buf := make([]byte, 1500)
+	n, addr, err := c.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom returned error: %s", err)
+	}
+	if string(buf[:n]) != "payload" {
+		t.Errorf("ReadFrom payload = %q, want %q", buf[:n], "payload")
+	}
+	if addr.String() != "1.2.3.4:9999" {
+		t.Errorf("ReadFrom addr = %q, want %q", addr.String(), "1.2.3.4:9999")
+	}
+}
+
+// TestSocks5UDPConnWriteTo checks the header this side constructs is the
+// inverse of what ReadFrom expects: RSV(2)+FRAG(1)+ATYP(1)+addr+port.
+func TestSocks5UDPConnWriteTo(t *testing.T) {
+	c, relay := newTestSocks5UDPPair(t)
+
+	dst := &net.UDPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 4242}
+	if _, err := c.WriteTo([]byte("hello"), dst); err != nil {
+		t.Fatalf("WriteTo returned error: %s", err)
+	}
+
+	buf := make([]byte, 1500)
+	n, err := relay.Read(buf)
+	if err != nil {
+		t.Fatalf("relay read: %s", err)
+	}
+	got := buf[:n]
+	if len(got) < 4 || got[0] != 0 || got[1] != 0 || got[2] != 0 {
+		t.Fatalf("datagram header = %v, want RSV(2)+FRAG(1) of zeros", got[:min(4, len(got))])
+	}
+	if got[3] != socks5AddrIPv4 {
+		t.Fatalf("ATYP = %d, want socks5AddrIPv4", got[3])
+	}
+	r := &byteConnReader{buf: got[4:]}
+	host, port, err := socks5ReadAddr(r, got[3])
+	if err != nil {
+		t.Fatalf("socks5ReadAddr: %s", err)
+	}
+	if host != "5.6.7.8" || port != 4242 {
+		t.Errorf("addr = %s:%d, want 5.6.7.8:4242", host, port)
+	}
+	if string(r.buf) != "hello" {
+		t.Errorf("payload = %q, want %q", r.buf, "hello")
+	}
+}
+
+func TestBindAddressDialer(t *testing.T) {
+	want := net.ParseIP("127.0.0.1")
+	nd := &net.Dialer{}
+	if err := bindAddressDialer(want)(nd); err != nil {
+		t.Fatalf("bindAddressDialer hook returned error: %s", err)
+	}
+	got, ok := nd.LocalAddr.(*net.TCPAddr)
+	if !ok || !got.IP.Equal(want) {
+		t.Errorf("nd.LocalAddr = %v, want a *net.TCPAddr with IP %s", nd.LocalAddr, want)
+	}
+}
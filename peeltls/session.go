@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"sync"
+	"time"
+
+	fhttp2 "github.com/Danny-Dasilva/fhttp/http2"
+	"golang.org/x/net/publicsuffix"
+)
+
+// sessionIdleTimeout is how long a Session may sit unused before the
+// evictor reclaims it and closes its pooled connections.
+const sessionIdleTimeout = 10 * time.Minute
+
+// sessionSweepInterval is how often the evictor scans for idle sessions.
+const sessionSweepInterval = 1 * time.Minute
+
+// Session is a persistent fetch context keyed by an opaque session ID. The
+// fingerprint and proxy are locked in at creation time, H2 connections are
+// reused per host across /fetch calls, and a cookie jar survives across
+// requests — so a login/CSRF flow stays coherent instead of being spread
+// across disconnected one-shot fetches.
+type Session struct {
+	ID               string
+	Fingerprint      string
+	HTTP2Fingerprint string
+	Proxy            ProxyChain
+	CookieJar        *cookiejar.Jar
+	MaxIdlePerHost   int
+
+	createdAt time.Time
+
+	mu         sync.Mutex
+	lastUsedAt time.Time
+	h2Conns    map[string][]*fhttp2.ClientConn // addr -> up to MaxIdlePerHost pooled H2 connections
+	cookies    map[string]storedCookie         // domain|path|name -> cookie, for enumeration (cookiejar.Jar can't be listed)
+}
+
+// storedCookie mirrors the fields of http.Cookie that matter for listing and
+// Netscape export. It's tracked alongside CookieJar because cookiejar.Jar
+// only answers "cookies for this URL", with no way to enumerate every
+// cookie it holds across domains.
+type storedCookie struct {
+	Domain   string
+	Path     string
+	Name     string
+	Value    string
+	Expires  time.Time
+	Secure   bool
+	HTTPOnly bool
+}
+
+// recordCookies mirrors cookies just handed to CookieJar.SetCookies into
+// s.cookies, so GET /session/{id}/cookies can enumerate them. reqHost is
+// the host the cookies were received from, used when a cookie has no
+// explicit Domain attribute (host-only cookies).
+func (s *Session) recordCookies(reqHost string, cookies []*http.Cookie) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range cookies {
+		domain := c.Domain
+		if domain == "" {
+			domain = reqHost
+		}
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+		key := domain + "\x00" + path + "\x00" + c.Name
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now())) {
+			delete(s.cookies, key)
+			continue
+		}
+		s.cookies[key] = storedCookie{
+			Domain:   domain,
+			Path:     path,
+			Name:     c.Name,
+			Value:    c.Value,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+		}
+	}
+}
+
+// listCookies returns every cookie currently tracked for the session.
+func (s *Session) listCookies() []storedCookie {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]storedCookie, 0, len(s.cookies))
+	for _, c := range s.cookies {
+		out = append(out, c)
+	}
+	return out
+}
+
+// touch marks the session as used just now, resetting its idle clock.
+func (s *Session) touch() {
+	s.mu.Lock()
+	s.lastUsedAt = time.Now()
+	s.mu.Unlock()
+}
+
+// getH2Conn returns a still-usable pooled H2 connection for addr, if any,
+// dropping any connections for addr that can no longer take new requests
+// along the way.
+func (s *Session) getH2Conn(addr string) *fhttp2.ClientConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conns := s.h2Conns[addr]
+	live := conns[:0]
+	var found *fhttp2.ClientConn
+	for _, cc := range conns {
+		if !cc.CanTakeNewRequest() {
+			continue
+		}
+		if found == nil {
+			found = cc
+		}
+		live = append(live, cc)
+	}
+	if len(live) == 0 {
+		delete(s.h2Conns, addr)
+	} else {
+		s.h2Conns[addr] = live
+	}
+	return found
+}
+
+// putH2Conn adds a newly-dialed H2 connection for addr to the session's
+// pool, closing the oldest pooled connection for addr first if it's already
+// at MaxIdlePerHost.
+func (s *Session) putH2Conn(addr string, cc *fhttp2.ClientConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	max := s.MaxIdlePerHost
+	if max <= 0 {
+		max = 1
+	}
+	conns := s.h2Conns[addr]
+	for len(conns) >= max {
+		conns[0].Close()
+		conns = conns[1:]
+	}
+	s.h2Conns[addr] = append(conns, cc)
+}
+
+// closeConns shuts down every pooled connection held by the session.
+func (s *Session) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for addr, conns := range s.h2Conns {
+		for _, cc := range conns {
+			cc.Close()
+		}
+		delete(s.h2Conns, addr)
+	}
+}
+
+// SessionInfo is the JSON-safe summary of a Session returned by /session/list.
+type SessionInfo struct {
+	ID               string     `json:"id"`
+	Fingerprint      string     `json:"fingerprint,omitempty"`
+	HTTP2Fingerprint string     `json:"http2Fingerprint,omitempty"`
+	Proxy            ProxyChain `json:"proxy,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	LastUsedAt       time.Time  `json:"lastUsedAt"`
+	PooledConns      int        `json:"pooledConns"`
+}
+
+// CreateSessionRequest is the JSON body for POST /session/create.
+type CreateSessionRequest struct {
+	Fingerprint      string     `json:"fingerprint"`
+	HTTP2Fingerprint string     `json:"http2Fingerprint"`
+	Proxy            ProxyChain `json:"proxy"`
+	MaxIdlePerHost   int        `json:"maxIdlePerHost"`
+}
+
+// sessionStore is the process-wide registry of live sessions, evicted on an
+// LRU/TTL basis so abandoned sessions don't leak file descriptors.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+var sessions = newSessionStore()
+
+func newSessionStore() *sessionStore {
+	st := &sessionStore{sessions: make(map[string]*Session)}
+	go st.evictLoop()
+	return st
+}
+
+// create starts a new Session with the given fingerprint/proxy locked in.
+func (st *sessionStore) create(req CreateSessionRequest) (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %s", err)
+	}
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie jar: %s", err)
+	}
+	maxIdle := req.MaxIdlePerHost
+	if maxIdle <= 0 {
+		maxIdle = 1
+	}
+
+	now := time.Now()
+	s := &Session{
+		ID:               id,
+		Fingerprint:      req.Fingerprint,
+		HTTP2Fingerprint: req.HTTP2Fingerprint,
+		Proxy:            req.Proxy,
+		CookieJar:        jar,
+		MaxIdlePerHost:   maxIdle,
+		createdAt:        now,
+		lastUsedAt:       now,
+		h2Conns:          make(map[string][]*fhttp2.ClientConn),
+		cookies:          make(map[string]storedCookie),
+	}
+
+	st.mu.Lock()
+	st.sessions[id] = s
+	st.mu.Unlock()
+	return s, nil
+}
+
+// get returns the session for id, touching its idle clock.
+func (st *sessionStore) get(id string) (*Session, bool) {
+	st.mu.Lock()
+	s, ok := st.sessions[id]
+	st.mu.Unlock()
+	if ok {
+		s.touch()
+	}
+	return s, ok
+}
+
+// closeSession removes and tears down the session for id.
+func (st *sessionStore) closeSession(id string) bool {
+	st.mu.Lock()
+	s, ok := st.sessions[id]
+	if ok {
+		delete(st.sessions, id)
+	}
+	st.mu.Unlock()
+	if ok {
+		s.closeConns()
+	}
+	return ok
+}
+
+// list returns a summary of every live session.
+func (st *sessionStore) list() []SessionInfo {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	infos := make([]SessionInfo, 0, len(st.sessions))
+	for _, s := range st.sessions {
+		s.mu.Lock()
+		pooledConns := 0
+		for _, conns := range s.h2Conns {
+			pooledConns += len(conns)
+		}
+		infos = append(infos, SessionInfo{
+			ID:               s.ID,
+			Fingerprint:      s.Fingerprint,
+			HTTP2Fingerprint: s.HTTP2Fingerprint,
+			Proxy:            s.Proxy,
+			CreatedAt:        s.createdAt,
+			LastUsedAt:       s.lastUsedAt,
+			PooledConns:      pooledConns,
+		})
+		s.mu.Unlock()
+	}
+	return infos
+}
+
+// evictLoop periodically closes and removes sessions that have been idle
+// past sessionIdleTimeout, so abandoned sessions don't leak connections.
+func (st *sessionStore) evictLoop() {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		st.evictIdle()
+	}
+}
+
+func (st *sessionStore) evictIdle() {
+	now := time.Now()
+
+	st.mu.Lock()
+	var stale []*Session
+	for id, s := range st.sessions {
+		s.mu.Lock()
+		idle := now.Sub(s.lastUsedAt)
+		s.mu.Unlock()
+		if idle > sessionIdleTimeout {
+			stale = append(stale, s)
+			delete(st.sessions, id)
+		}
+	}
+	st.mu.Unlock()
+
+	for _, s := range stale {
+		s.closeConns()
+	}
+}
+
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionCreateDefaultsMaxIdlePerHost(t *testing.T) {
+	st := newSessionStore()
+	s, err := st.create(CreateSessionRequest{})
+	if err != nil {
+		t.Fatalf("create returned error: %s", err)
+	}
+	if s.MaxIdlePerHost != 1 {
+		t.Errorf("MaxIdlePerHost = %d, want 1 (default)", s.MaxIdlePerHost)
+	}
+
+	s2, err := st.create(CreateSessionRequest{MaxIdlePerHost: 4})
+	if err != nil {
+		t.Fatalf("create returned error: %s", err)
+	}
+	if s2.MaxIdlePerHost != 4 {
+		t.Errorf("MaxIdlePerHost = %d, want 4", s2.MaxIdlePerHost)
+	}
+}
+
+// TestSessionStoreEvictIdle guards the idle-eviction sweep: a session last
+// used longer than sessionIdleTimeout ago is removed, one still within the
+// window is kept.
+func TestSessionStoreEvictIdle(t *testing.T) {
+	st := newSessionStore()
+
+	stale, err := st.create(CreateSessionRequest{})
+	if err != nil {
+		t.Fatalf("create returned error: %s", err)
+	}
+	fresh, err := st.create(CreateSessionRequest{})
+	if err != nil {
+		t.Fatalf("create returned error: %s", err)
+	}
+
+	stale.mu.Lock()
+	stale.lastUsedAt = time.Now().Add(-2 * sessionIdleTimeout)
+	stale.mu.Unlock()
+
+	st.evictIdle()
+
+	if _, ok := st.get(stale.ID); ok {
+		t.Error("evictIdle did not remove a session idle past sessionIdleTimeout")
+	}
+	if _, ok := st.get(fresh.ID); !ok {
+		t.Error("evictIdle removed a session that was still within its idle window")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// defaultStreamMaxRetries is how many times doFetchStream re-issues the
+// origin request with a Range offset after the connection drops mid-body,
+// when FetchRequest.maxRetries is left unset.
+const defaultStreamMaxRetries = 3
+
+// errBodyTooLarge is reported via the X-Webpeel-Error trailer when a
+// streamed body is cut off by FetchRequest.maxBodyBytes.
+var errBodyTooLarge = errors.New("response body exceeds maxBodyBytes cap")
+
+// doFetchStream is the streaming counterpart to doFetch: instead of
+// buffering the whole body into a FetchResponse.Body string, it pipes
+// decompressed bytes straight through to w as they arrive, so a large
+// asset doesn't have to fit in memory twice (once in fetchOnce's response,
+// once again base64-through-JSON). Status and headers are written to w as
+// soon as the first origin response lands; after that, doFetchStream can
+// no longer report errors through the status line, so any failure past
+// that point is surfaced as the X-Webpeel-Error trailer instead.
+//
+// If the origin connection drops mid-body, doFetchStream re-issues the
+// request with a Range header starting at the last byte it forwarded to
+// w, up to maxRetries times, so a dropped connection resumes instead of
+// truncating the transfer.
+func doFetchStream(req FetchRequest, w http.ResponseWriter) {
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+	if req.Fingerprint == "" {
+		req.Fingerprint = "chrome-133"
+	}
+	if req.MaxRedirects <= 0 {
+		req.MaxRedirects = 10
+	}
+	maxRetries := req.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultStreamMaxRetries
+	}
+
+	timeouts := resolveTimeouts(req)
+	trust, err := resolveTLSTrust(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	currentURL := req.URL
+	visited := make(map[string]bool)
+	redirectCount := 0
+	headersSent := false
+	var sent int64    // decompressed bytes forwarded to w so far, for the maxBodyBytes cap
+	var rawSent int64 // raw (pre-decompression) bytes consumed from the origin so far, for the Range resume offset
+
+	for {
+		// visited/redirect-loop detection only applies while still
+		// following redirects, before headers are committed to w — once
+		// we're retrying the same URL to resume a dropped connection,
+		// seeing currentURL again is expected, not a loop.
+		if !headersSent {
+			if visited[currentURL] {
+				http.Error(w, "redirect loop detected", http.StatusBadGateway)
+				return
+			}
+			visited[currentURL] = true
+		}
+
+		headers := req.Headers
+		resumeFrom := req.RangeStart + rawSent
+		if resumeFrom > 0 {
+			headers = withRangeHeader(headers, resumeFrom)
+		}
+
+		resp, ferr := fetchOnce(currentURL, req.Method, headers, req.Fingerprint, req.HTTP2Fingerprint, req.QUICFingerprint, req.Protocol, req.Proxy, req.SessionID, timeouts, trust, nil, &FetchTiming{})
+		if ferr != nil {
+			if !headersSent {
+				http.Error(w, ferr.Error(), http.StatusBadGateway)
+				return
+			}
+			if maxRetries <= 0 {
+				w.Header().Set("X-Webpeel-Error", ferr.Error())
+				return
+			}
+			maxRetries--
+			continue
+		}
+
+		if req.FollowRedirects && !headersSent && isRedirect(resp.StatusCode) {
+			location := resp.Header.Get("Location")
+			if location != "" {
+				resolved, ok := resolveRedirect(currentURL, location)
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if ok {
+					redirectCount++
+					if redirectCount > req.MaxRedirects {
+						http.Error(w, fmt.Sprintf("too many redirects (max %d)", req.MaxRedirects), http.StatusBadGateway)
+						return
+					}
+					currentURL = resolved
+					continue
+				}
+			}
+		}
+
+		if resumeFrom > 0 && resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			msg := "origin did not honor Range on resume"
+			if !headersSent {
+				http.Error(w, msg, http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("X-Webpeel-Error", msg)
+			return
+		}
+
+		if !headersSent {
+			w.Header().Del("Content-Type") // authMiddleware defaults this to application/json; the origin's own value takes over
+			for k, vs := range resp.Header {
+				if k == "Content-Length" || k == "Content-Encoding" || k == "Content-Range" {
+					continue
+				}
+				for _, v := range vs {
+					w.Header().Add(k, v)
+				}
+			}
+			w.Header().Set("X-Webpeel-Final-Url", currentURL)
+			w.Header().Set("Trailer", "X-Webpeel-Error")
+			w.WriteHeader(resp.StatusCode)
+			headersSent = true
+		}
+
+		var rawThisAttempt int64
+		resp.Body = &countingReadCloser{rc: resp.Body, n: &rawThisAttempt}
+
+		decReader, derr := streamDecompressReader(resp)
+		if derr != nil {
+			resp.Body.Close()
+			w.Header().Set("X-Webpeel-Error", "decompression failed: "+derr.Error())
+			return
+		}
+
+		capRemaining := int64(-1)
+		if req.MaxBodyBytes > 0 {
+			capRemaining = req.MaxBodyBytes - sent
+			if capRemaining <= 0 {
+				resp.Body.Close()
+				w.Header().Set("X-Webpeel-Error", errBodyTooLarge.Error())
+				return
+			}
+		}
+
+		n, cerr := copyCapped(w, flusher, decReader, capRemaining)
+		sent += n
+		rawSent += rawThisAttempt
+		resp.Body.Close()
+
+		if cerr == nil {
+			return
+		}
+		if cerr == errBodyTooLarge {
+			w.Header().Set("X-Webpeel-Error", cerr.Error())
+			return
+		}
+		if maxRetries <= 0 {
+			w.Header().Set("X-Webpeel-Error", "stream interrupted: "+cerr.Error())
+			return
+		}
+		maxRetries--
+	}
+}
+
+// resolveRedirect resolves a Location header against currentURL, the same
+// way doFetch's redirect loop does.
+func resolveRedirect(currentURL, location string) (string, bool) {
+	base, err := url.Parse(currentURL)
+	if err != nil {
+		return "", false
+	}
+	loc, err := url.Parse(location)
+	if err != nil {
+		return "", false
+	}
+	return base.ResolveReference(loc).String(), true
+}
+
+// withRangeHeader returns a copy of headers with a Range request set for
+// resuming at offset, leaving the caller's original map untouched.
+func withRangeHeader(headers map[string]string, offset int64) map[string]string {
+	merged := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		merged[k] = v
+	}
+	merged["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	return merged
+}
+
+// countingReadCloser wraps an io.ReadCloser, tallying raw bytes read into
+// *n. doFetchStream uses it on resp.Body, below any decompression, so a
+// Range resume addresses the origin's wire bytes rather than the
+// decompressed bytes handed to the client.
+type countingReadCloser struct {
+	rc io.ReadCloser
+	n  *int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.rc.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReadCloser) Close() error {
+	return c.rc.Close()
+}
+
+// streamDecompressReader is the streaming counterpart to decompressBody:
+// it wraps resp.Body in a decompressing io.ReadCloser instead of buffering
+// the whole thing with io.ReadAll.
+func streamDecompressReader(resp *http.Response) (io.ReadCloser, error) {
+	encoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	switch encoding {
+	case "gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		return flate.NewReader(resp.Body), nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(resp.Body)), nil
+	default:
+		return resp.Body, nil
+	}
+}
+
+// copyCapped copies from src to dst, flushing dst after every chunk written
+// (flusher may be nil), stopping early with errBodyTooLarge once max bytes
+// have been written. max < 0 means no cap.
+func copyCapped(dst io.Writer, flusher http.Flusher, src io.Reader, max int64) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			if max >= 0 && written+int64(n) > max {
+				chunk = chunk[:max-written]
+			}
+			if len(chunk) > 0 {
+				if _, werr := dst.Write(chunk); werr != nil {
+					return written, werr
+				}
+				written += int64(len(chunk))
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+			if max >= 0 && written >= max {
+				return written, errBodyTooLarge
+			}
+		}
+		if rerr != nil {
+			if rerr == io.EOF {
+				return written, nil
+			}
+			return written, rerr
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestResolveRedirect(t *testing.T) {
+	got, ok := resolveRedirect("https://example.com/a/b", "/c")
+	if !ok || got != "https://example.com/c" {
+		t.Errorf("resolveRedirect absolute-path = (%q, %v), want (\"https://example.com/c\", true)", got, ok)
+	}
+
+	got, ok = resolveRedirect("https://example.com/a/b", "https://other.com/x")
+	if !ok || got != "https://other.com/x" {
+		t.Errorf("resolveRedirect cross-host = (%q, %v), want (\"https://other.com/x\", true)", got, ok)
+	}
+
+	if _, ok := resolveRedirect("://not a url", "/c"); ok {
+		t.Error("resolveRedirect with an unparseable base should report ok=false")
+	}
+}
+
+func TestWithRangeHeader(t *testing.T) {
+	orig := map[string]string{"Accept": "*/*"}
+	got := withRangeHeader(orig, 1024)
+
+	if got["Range"] != "bytes=1024-" {
+		t.Errorf("Range header = %q, want %q", got["Range"], "bytes=1024-")
+	}
+	if got["Accept"] != "*/*" {
+		t.Errorf("existing header lost: Accept = %q", got["Accept"])
+	}
+	if _, ok := orig["Range"]; ok {
+		t.Error("withRangeHeader mutated the caller's original map")
+	}
+}
+
+func TestCopyCappedNoLimit(t *testing.T) {
+	var dst bytes.Buffer
+	n, err := copyCapped(&dst, nil, strings.NewReader("hello world"), -1)
+	if err != nil {
+		t.Fatalf("copyCapped returned error: %s", err)
+	}
+	if n != int64(len("hello world")) || dst.String() != "hello world" {
+		t.Errorf("copyCapped copied %q (n=%d), want \"hello world\"", dst.String(), n)
+	}
+}
+
+func TestCopyCappedTruncates(t *testing.T) {
+	var dst bytes.Buffer
+	n, err := copyCapped(&dst, nil, strings.NewReader("hello world"), 5)
+	if err != errBodyTooLarge {
+		t.Fatalf("copyCapped err = %v, want errBodyTooLarge", err)
+	}
+	if n != 5 || dst.String() != "hello" {
+		t.Errorf("copyCapped copied %q (n=%d), want \"hello\" (n=5)", dst.String(), n)
+	}
+}
+
+func TestStreamDecompressReader(t *testing.T) {
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("gzipped"))
+	gw.Close()
+
+	resp := &http.Response{
+		Header: http.Header{"Content-Encoding": []string{"gzip"}},
+		Body:   io.NopCloser(bytes.NewReader(gz.Bytes())),
+	}
+	r, err := streamDecompressReader(resp)
+	if err != nil {
+		t.Fatalf("streamDecompressReader(gzip) returned error: %s", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading decompressed body: %s", err)
+	}
+	if string(got) != "gzipped" {
+		t.Errorf("decompressed body = %q, want %q", got, "gzipped")
+	}
+
+	identity := &http.Response{Header: http.Header{}, Body: io.NopCloser(strings.NewReader("plain"))}
+	r, err = streamDecompressReader(identity)
+	if err != nil {
+		t.Fatalf("streamDecompressReader(identity) returned error: %s", err)
+	}
+	got, _ = io.ReadAll(r)
+	if string(got) != "plain" {
+		t.Errorf("identity body = %q, want %q", got, "plain")
+	}
+}
+
+func TestCountingReadCloser(t *testing.T) {
+	var n int64
+	c := &countingReadCloser{rc: io.NopCloser(strings.NewReader("12345")), n: &n}
+	buf := make([]byte, 3)
+	if _, err := c.Read(buf); err != nil {
+		t.Fatalf("Read returned error: %s", err)
+	}
+	if n != 3 {
+		t.Errorf("n = %d after first Read, want 3", n)
+	}
+	io.ReadAll(c)
+	if n != 5 {
+		t.Errorf("n = %d after draining, want 5", n)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close returned error: %s", err)
+	}
+}
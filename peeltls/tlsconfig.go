@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	tls "github.com/refraction-networking/utls"
+)
+
+// allowedSkipVerifyHosts is the server-level whitelist of hostnames a
+// /fetch request may set insecureSkipVerify for. Empty (the default) means
+// no request may disable verification, mirroring git-lfs's SkipSSLVerify
+// being an explicit opt-in rather than something arbitrary callers control.
+// An entry of "*" allows any host, for local development.
+var allowedSkipVerifyHosts = map[string]bool{}
+
+// SetAllowedSkipVerifyHosts installs the server-level skipVerify whitelist,
+// replacing whatever was set before.
+func SetAllowedSkipVerifyHosts(hosts []string) {
+	m := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		if h = strings.TrimSpace(h); h != "" {
+			m[strings.ToLower(h)] = true
+		}
+	}
+	allowedSkipVerifyHosts = m
+}
+
+func skipVerifyAllowed(hostname string) bool {
+	return allowedSkipVerifyHosts["*"] || allowedSkipVerifyHosts[strings.ToLower(hostname)]
+}
+
+// TLSTrust carries a single fetch's TLS trust decisions: whether to skip
+// verification, a custom CA bundle in place of the system roots, and an
+// optional client certificate for mTLS-protected origins.
+type TLSTrust struct {
+	InsecureSkipVerify bool
+	RootCAs            *x509.CertPool
+	Certificates       []tls.Certificate
+}
+
+// resolveTLSTrust builds the TLSTrust for req, loading the CA bundle and
+// client certificate if set. It does not check insecureSkipVerify against
+// the server-level whitelist — that's enforced where the hostname being
+// connected to is known, in fetchOnce.
+func resolveTLSTrust(req FetchRequest) (TLSTrust, error) {
+	trust := TLSTrust{InsecureSkipVerify: req.InsecureSkipVerify}
+
+	if req.CABundle != "" {
+		pool, err := loadCABundle(req.CABundle)
+		if err != nil {
+			return TLSTrust{}, fmt.Errorf("failed to load CA bundle: %s", err)
+		}
+		trust.RootCAs = pool
+	}
+
+	if req.ClientCert != "" || req.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(req.ClientCert), []byte(req.ClientKey))
+		if err != nil {
+			return TLSTrust{}, fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		trust.Certificates = []tls.Certificate{cert}
+	}
+
+	return trust, nil
+}
+
+// loadCABundle parses caBundle as an inline PEM string. Unlike
+// insecureSkipVerify, there's no server-level host whitelist that would
+// make a filesystem-path form of this setting safe — reading an arbitrary
+// server-local path on behalf of any caller holding the bearer token would
+// turn this into a file-read oracle, so only inline PEM is accepted.
+func loadCABundle(caBundle string) (*x509.CertPool, error) {
+	if !strings.Contains(caBundle, "-----BEGIN") {
+		return nil, fmt.Errorf("caBundle must be an inline PEM string")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caBundle)) {
+		return nil, fmt.Errorf("no valid certificates found in CA bundle")
+	}
+	return pool, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestLoadCABundle(t *testing.T) {
+	const validPEM = `-----BEGIN CERTIFICATE-----
+MIIC/zCCAeegAwIBAgIUIzJT5HPrEowzln2QHVCKDeUGRjkwDQYJKoZIhvcNAQEL
+BQAwDzENMAsGA1UEAwwEdGVzdDAeFw0yNjA3MjkwNTQxMzFaFw0zNjA3MjYwNTQx
+MzFaMA8xDTALBgNVBAMMBHRlc3QwggEiMA0GCSqGSIb3DQEBAQUAA4IBDwAwggEK
+AoIBAQC21mSA89t0fkj8+hWt6wu4fpZdoiHssdkco8PAZnVuWfUQwjk9hK54aU0V
+K+ZhArCBNbbeHuETr6KKisgoUYA+vuJK9knio2eKWjez3G2hZS6OpjIUl/EtOjs7
+AClzVZgPcVYRDZlhV1mRLHo5FUzg3HFNgm20rCgJcy6i0PfwfjQEGUXl4Lbwbv7p
+kOHxxH1r6VgLvjAWBDupbs253cMkMPJTdZGilEn0zMWqSs1flkCjqTYiApg3bCRf
+eM+XFZ/a0UbXu+NKgs21XQUf3bMFvEZNUCjBIkvkygy4ZrgsxO5x9edOO5PuXQL2
+RMeX1Nw/qgwS+J7kucMFYoSCsK7VAgMBAAGjUzBRMB0GA1UdDgQWBBQAqLULVqqh
+T6844DuDMnaG9uX5djAfBgNVHSMEGDAWgBQAqLULVqqhT6844DuDMnaG9uX5djAP
+BgNVHRMBAf8EBTADAQH/MA0GCSqGSIb3DQEBCwUAA4IBAQBEEuTtzmWvdKuAy+BV
+H4deRqB0vyBVgjd+gkTwAp0Nr77TjDkbTV0Oy7iwi/AlwnCJ2sTFKivACA6kaLOc
+0b4SByiQhQSXzMetSeQ3f1Iv3ItrbdrtfhViZEyeKy2Sb+Xonl/uGtAsndnsddak
+fSRXVzNGNxf9Ln0bA9pHjryMXeMX263TgbkiE7RmVe+LfuzJp01+wfKrMVgR5JlX
+TyB0tuLt6hW+JF44xnzOucjkvFeXtn83VtC5iEcRnkDfxNG3pLneI8ZRHccfcxik
+s3VKLS2WVt7egdrk24U91Mdrlg42dcYbs3u2UcI37k4lbEli72Hcd+QYi00qS778
+U3Yo
+-----END CERTIFICATE-----`
+
+	pool, err := loadCABundle(validPEM)
+	if err != nil {
+		t.Fatalf("loadCABundle(validPEM) returned error: %s", err)
+	}
+	if pool == nil {
+		t.Fatal("loadCABundle(validPEM) returned a nil pool")
+	}
+
+	if _, err := loadCABundle(""); err == nil {
+		t.Error("loadCABundle(\"\") should have errored")
+	}
+	if _, err := loadCABundle("/etc/ssl/certs/ca-certificates.crt"); err == nil {
+		t.Error("loadCABundle with a filesystem path (no -----BEGIN marker) should be rejected, not read off disk")
+	}
+	if _, err := loadCABundle("-----BEGIN CERTIFICATE-----\nnot valid base64 pem data\n-----END CERTIFICATE-----"); err == nil {
+		t.Error("loadCABundle with malformed PEM content should have errored")
+	}
+}
+
+func TestSkipVerifyAllowed(t *testing.T) {
+	defer SetAllowedSkipVerifyHosts(nil)
+
+	SetAllowedSkipVerifyHosts([]string{"Example.com", " internal.test "})
+	if !skipVerifyAllowed("example.com") {
+		t.Error("skipVerifyAllowed(\"example.com\") = false, want true (case-insensitive match)")
+	}
+	if !skipVerifyAllowed("internal.test") {
+		t.Error("skipVerifyAllowed(\"internal.test\") = false, want true (whitespace-trimmed match)")
+	}
+	if skipVerifyAllowed("other.com") {
+		t.Error("skipVerifyAllowed(\"other.com\") = true, want false")
+	}
+
+	SetAllowedSkipVerifyHosts([]string{"*"})
+	if !skipVerifyAllowed("anything.example") {
+		t.Error("skipVerifyAllowed with a \"*\" entry should allow any host")
+	}
+}
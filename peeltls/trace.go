@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	fhttp "github.com/Danny-Dasilva/fhttp"
+	fhttp2 "github.com/Danny-Dasilva/fhttp/http2"
+)
+
+// TraceInfo captures wire-level fingerprint and request/response detail for
+// a single fetch, the equivalent of git-lfs's tracerx dumps. It's only
+// populated when a fetch opts into FetchRequest.Trace (or WEBPEEL_TRACE is
+// set), threaded through fetchOnce and the doHTTP1/doHTTP2* helpers as a
+// pointer and filled in-place alongside FetchTiming, so a non-tracing fetch
+// pays nothing for it.
+type TraceInfo struct {
+	JA3             string            `json:"ja3,omitempty"`
+	JA3Hash         string            `json:"ja3Hash,omitempty"`
+	ALPN            string            `json:"alpn,omitempty"`
+	H2Settings      []string          `json:"h2Settings,omitempty"`
+	RequestLine     string            `json:"requestLine,omitempty"`
+	RequestHeaders  map[string]string `json:"requestHeaders,omitempty"`
+	ResponseStatus  int               `json:"responseStatus,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+}
+
+// traceEnabled reports whether req opted into tracing, either directly or
+// via the WEBPEEL_TRACE environment variable, for one-off debugging without
+// editing every call site.
+func traceEnabled(req FetchRequest) bool {
+	return req.Trace || os.Getenv("WEBPEEL_TRACE") != ""
+}
+
+// traceClientHello fills in trace's JA3/ALPN fields. No-op if trace is nil.
+func traceClientHello(trace *TraceInfo, ja3, ja3Hash, alpn string) {
+	if trace == nil {
+		return
+	}
+	trace.JA3 = ja3
+	trace.JA3Hash = ja3Hash
+	trace.ALPN = alpn
+}
+
+// traceH2Settings renders an H2FingerprintSpec's SETTINGS frame as
+// "id:value" pairs in send order. No-op if trace is nil.
+func traceH2Settings(trace *TraceInfo, settings []fhttp2.Setting) {
+	if trace == nil {
+		return
+	}
+	rendered := make([]string, 0, len(settings))
+	for _, s := range settings {
+		rendered = append(rendered, fmt.Sprintf("%d:%d", s.ID, s.Val))
+	}
+	trace.H2Settings = rendered
+}
+
+// traceHTTP1Request fills in trace's request-line/header fields from an
+// http.Request about to be written on the wire. No-op if trace is nil.
+func traceHTTP1Request(trace *TraceInfo, req *http.Request) {
+	if trace == nil {
+		return
+	}
+	trace.RequestLine = fmt.Sprintf("%s %s HTTP/1.1", req.Method, req.URL.RequestURI())
+	trace.RequestHeaders = flattenHeader(req.Header)
+}
+
+// traceHTTP1Response fills in trace's response status/header fields. No-op
+// if trace is nil.
+func traceHTTP1Response(trace *TraceInfo, resp *http.Response) {
+	if trace == nil {
+		return
+	}
+	trace.ResponseStatus = resp.StatusCode
+	trace.ResponseHeaders = flattenHeader(resp.Header)
+}
+
+// traceHTTP2Request fills in trace's request-line/header fields from an
+// fhttp.Request about to be sent over the H2 connection. No-op if trace is
+// nil.
+func traceHTTP2Request(trace *TraceInfo, req *fhttp.Request) {
+	if trace == nil {
+		return
+	}
+	trace.RequestLine = fmt.Sprintf("%s %s HTTP/2.0", req.Method, req.URL.RequestURI())
+	trace.RequestHeaders = flattenHeader(http.Header(req.Header))
+}
+
+// traceHTTP2Response fills in trace's response status/header fields from an
+// fhttp.Response. No-op if trace is nil.
+func traceHTTP2Response(trace *TraceInfo, resp *fhttp.Response) {
+	if trace == nil {
+		return
+	}
+	trace.ResponseStatus = resp.StatusCode
+	trace.ResponseHeaders = flattenHeader(http.Header(resp.Header))
+}
+
+func flattenHeader(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, vs := range h {
+		out[k] = strings.Join(vs, ", ")
+	}
+	return out
+}
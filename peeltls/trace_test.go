@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	fhttp2 "github.com/Danny-Dasilva/fhttp/http2"
+)
+
+func TestTraceEnabled(t *testing.T) {
+	if traceEnabled(FetchRequest{}) {
+		t.Error("traceEnabled(FetchRequest{}) = true, want false")
+	}
+	if !traceEnabled(FetchRequest{Trace: true}) {
+		t.Error("traceEnabled(Trace: true) = false, want true")
+	}
+
+	os.Setenv("WEBPEEL_TRACE", "1")
+	defer os.Unsetenv("WEBPEEL_TRACE")
+	if !traceEnabled(FetchRequest{}) {
+		t.Error("traceEnabled with WEBPEEL_TRACE set = false, want true")
+	}
+}
+
+func TestTraceNilIsNoop(t *testing.T) {
+	// All trace* helpers must be no-ops on a nil *TraceInfo, since most
+	// fetches don't opt into tracing and shouldn't pay for it.
+	traceClientHello(nil, "ja3", "hash", "h2")
+	traceH2Settings(nil, nil)
+	traceHTTP1Request(nil, &http.Request{Method: "GET", URL: mustParseURL(t, "https://example.com")})
+	traceHTTP1Response(nil, &http.Response{StatusCode: 200, Header: http.Header{}})
+}
+
+func TestTraceClientHello(t *testing.T) {
+	var trace TraceInfo
+	traceClientHello(&trace, "771,...", "deadbeef", "h2")
+	if trace.JA3 != "771,..." || trace.JA3Hash != "deadbeef" || trace.ALPN != "h2" {
+		t.Errorf("trace = %+v, unexpected fields", trace)
+	}
+}
+
+func TestTraceH2Settings(t *testing.T) {
+	var trace TraceInfo
+	traceH2Settings(&trace, []fhttp2.Setting{{ID: 1, Val: 4096}, {ID: 3, Val: 100}})
+	want := []string{"1:4096", "3:100"}
+	if len(trace.H2Settings) != len(want) || trace.H2Settings[0] != want[0] || trace.H2Settings[1] != want[1] {
+		t.Errorf("H2Settings = %v, want %v", trace.H2Settings, want)
+	}
+}
+
+func TestTraceHTTP1RequestResponse(t *testing.T) {
+	var trace TraceInfo
+	req := &http.Request{Method: "GET", URL: mustParseURL(t, "https://example.com/a?b=1"), Header: http.Header{"X-Foo": []string{"bar"}}}
+	traceHTTP1Request(&trace, req)
+	if trace.RequestLine != "GET /a?b=1 HTTP/1.1" {
+		t.Errorf("RequestLine = %q", trace.RequestLine)
+	}
+	if trace.RequestHeaders["X-Foo"] != "bar" {
+		t.Errorf("RequestHeaders[X-Foo] = %q, want %q", trace.RequestHeaders["X-Foo"], "bar")
+	}
+
+	resp := &http.Response{StatusCode: 404, Header: http.Header{"Content-Type": []string{"text/plain"}}}
+	traceHTTP1Response(&trace, resp)
+	if trace.ResponseStatus != 404 || trace.ResponseHeaders["Content-Type"] != "text/plain" {
+		t.Errorf("response trace = %+v, unexpected fields", trace)
+	}
+}
+
+func TestFlattenHeader(t *testing.T) {
+	h := http.Header{"Set-Cookie": []string{"a=1", "b=2"}}
+	got := flattenHeader(h)
+	if got["Set-Cookie"] != "a=1, b=2" {
+		t.Errorf("flattenHeader joined multi-value header = %q, want %q", got["Set-Cookie"], "a=1, b=2")
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parsing test URL %q: %s", raw, err)
+	}
+	return u
+}